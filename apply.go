@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/kong"
+	"howett.net/plist"
+)
+
+type applyCmd struct {
+	From              string `kong:"required,placeholder=TREE,help='tree to apply the changes to'"`
+	To                string `kong:"placeholder=TREE,help='tree with the changes to apply'"`
+	Overlay           string `kong:"type=existingfile,placeholder=FILE,help='overlay from --format=overlay with the changes to apply instead of --to. changed plists are written as XML'"`
+	Output            string `kong:"required,placeholder=DIR,help='directory to write the updated tree to. it must not exist or be empty'"`
+	PermissionsErrors bool   `kong:"help='return an error when a file cannot be opened due to insufficient permissions. these errors are ignored by default'"`
+}
+
+// Run writes the plists from From to Output, replacing the ones that differ from To with To's version.
+// Plists that are only in To are added and plists that are only in From are left out.
+func (c *applyCmd) Run(kctx *kong.Context) error {
+	d := &differ{
+		IgnorePermissionError: !c.PermissionsErrors,
+	}
+	if (c.To == "") == (c.Overlay == "") {
+		return fmt.Errorf("exactly one of --to and --overlay is required")
+	}
+	err := checkEmptyDir(c.Output)
+	if err != nil {
+		return err
+	}
+	if c.Overlay != "" {
+		return c.applyOverlay(kctx, d)
+	}
+	trees, err := d.getFSs(c.From, c.To)
+	if err != nil {
+		return err
+	}
+	from, to := trees[0], trees[1]
+	_, diff, err := d.diffFS(from, to)
+	if err != nil {
+		return err
+	}
+	files, err := d.getPlistFiles(from)
+	if err != nil {
+		return err
+	}
+	for filename := range diff {
+		files[filename] = struct{}{}
+	}
+	var applied int
+	for filename := range files {
+		src := from
+		if diff[filename].changes() > 0 {
+			src = to
+			applied++
+		}
+		err = copyFile(src, filename, filepath.Join(c.Output, filepath.FromSlash(filename)))
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(kctx.Stderr, "applied changes to %d files\n", applied)
+	return nil
+}
+
+// applyOverlay writes the plists from From to Output with the patches from Overlay applied.
+func (c *applyCmd) applyOverlay(kctx *kong.Context, d *differ) error {
+	patches, err := readOverlay(c.Overlay)
+	if err != nil {
+		return err
+	}
+	from, err := d.getFS(c.From)
+	if err != nil {
+		return err
+	}
+	files, err := d.getPlistFiles(from)
+	if err != nil {
+		return err
+	}
+	for filename := range patches {
+		files[filename] = struct{}{}
+	}
+	for filename := range files {
+		dest := filepath.Join(c.Output, filepath.FromSlash(filename))
+		patch, ok := patches[filename]
+		if !ok {
+			err = copyFile(from, filename, dest)
+		} else {
+			err = d.patchFile(from, filename, patch, dest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(kctx.Stderr, "applied changes to %d files\n", len(patches))
+	return nil
+}
+
+// readOverlay returns the patches for each filename in an overlay from --format=overlay
+func readOverlay(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	patches, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a dict of filenames to patches", filename)
+	}
+	return patches, nil
+}
+
+// patchFile writes filename from fsys to dest as XML with patch applied. Files that patch deletes
+// aren't written. Files that aren't in fsys are patched from nothing.
+func (d *differ) patchFile(fsys fs.FS, filename string, patch interface{}, dest string) error {
+	if p, ok := patch.(map[string]interface{}); ok && p[overlayDeleteFile] == true {
+		return nil
+	}
+	data, err := d.readFile(fsys, filename)
+	if err != nil {
+		return err
+	}
+	var target interface{}
+	if data != nil {
+		target, _, err = decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	out, err := plist.MarshalIndent(applyOverlay(target, patch), plist.XMLFormat, "\t")
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, append(out, '\n'), 0o644)
+}
+
+// checkEmptyDir returns an error when dir exists and isn't an empty directory.
+func checkEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", dir)
+	}
+	return nil
+}
+
+// copyFile copies filename from fsys to dest. It does nothing when filename isn't in fsys.
+func copyFile(fsys fs.FS, filename, dest string) error {
+	info, err := fs.Stat(fsys, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := fs.ReadFile(fsys, filename)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, info.Mode().Perm())
+}
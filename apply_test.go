@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApplyOverlay(t *testing.T) {
+	dir := t.TempDir()
+	overlay := filepath.Join(dir, "overlay.plist")
+	output := filepath.Join(dir, "out")
+	a, b := filepath.Join("testdata", "overlay", "a"), filepath.Join("testdata", "overlay", "b")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--format=overlay", a, b}, &stdout, &stderr); code != 0 {
+		t.Fatalf("--format=overlay exit code %d. stderr: %s", code, stderr.String())
+	}
+	err := os.WriteFile(overlay, stdout.Bytes(), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"apply", "--from", a, "--overlay", overlay, "--output", output}, &stdout, &stderr); code != 0 {
+		t.Fatalf("apply exit code %d. stderr: %s", code, stderr.String())
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{output, b}, &stdout, &stderr); code != 0 || stdout.Len() > 0 {
+		t.Errorf("applied overlay differs from %s:\n%s%s", b, stdout.String(), stderr.String())
+	}
+}
+
+func TestApplyOverlayEscapedKeys(t *testing.T) {
+	target := map[string]interface{}{"$delete": "old", "Keep": "1"}
+	patch := map[string]interface{}{
+		"$$delete": "new",
+		"$$array":  map[string]interface{}{"$$insert": "x"},
+		"$delete":  []interface{}{"Keep"},
+	}
+	want := map[string]interface{}{
+		"$delete": "new",
+		"$array":  map[string]interface{}{"$insert": "x"},
+	}
+	if diff := cmp.Diff(want, applyOverlay(target, patch)); diff != "" {
+		t.Errorf("applied (-want +got):\n%s", diff)
+	}
+}
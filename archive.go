@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// isArchive is true for filenames with the extension of an archive that getFS reads as a tree.
+func isArchive(filename string) bool {
+	lower := strings.ToLower(filename)
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveFS reads the regular files in a tar, gzipped tar or zip archive into a tree. The first
+// d.StripComponents directories are removed from each path like tar's --strip-components. Files
+// with no path left after that are skipped.
+func (d *differ) archiveFS(filename string) (fs.FS, error) {
+	tree := newMemFS()
+	add := func(name string, modTime time.Time, r io.Reader) error {
+		name = stripComponents(name, d.StripComponents)
+		if name == "" {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return writeSnapshotEntry(tree, name, snapshotEntry{
+			Data:    data,
+			ModTime: modTime,
+		})
+	}
+	var err error
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		err = readZip(filename, add)
+	} else {
+		err = readTar(filename, add)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return tree, nil
+}
+
+// stripComponents removes the first n directories from name. It returns "" when there is nothing
+// left.
+func stripComponents(name string, n int) string {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return ""
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) <= n {
+		return ""
+	}
+	return strings.Join(parts[n:], "/")
+}
+
+func readTar(filename string, add func(name string, modTime time.Time, r io.Reader) error) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck // only reading
+	var r io.Reader = file
+	lower := strings.ToLower(filename)
+	if strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".gz") {
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close() //nolint:errcheck // only reading
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = add(hdr.Name, hdr.ModTime, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readZip(filename string, add func(name string, modTime time.Time, r io.Reader) error) error {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer zr.Close() //nolint:errcheck // only reading
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		var rc io.ReadCloser
+		rc, err = zf.Open()
+		if err != nil {
+			return err
+		}
+		err = add(zf.Name, zf.Modified, rc)
+		_ = rc.Close() //nolint:errcheck // only reading
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
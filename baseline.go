@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+type baselineCmd struct {
+	Save baselineSaveCmd `kong:"cmd,help='save a snapshot of a tree as a named baseline'"`
+	Diff baselineDiffCmd `kong:"cmd,help='compare a tree to a named baseline'"`
+	List baselineListCmd `kong:"cmd,help='list saved baselines'"`
+	Rm   baselineRmCmd   `kong:"cmd,help='remove a saved baseline'"`
+}
+
+type baselineSaveCmd struct {
+	Name              string        `kong:"arg,help='name of the baseline'"`
+	Tree              string        `kong:"arg,help='directory tree (or file) to save'"`
+	PermissionsErrors bool          `kong:"help='return an error when a file cannot be opened due to insufficient permissions. these errors are ignored by default'"`
+	Timeout           time.Duration `kong:"default=30s,placeholder=DURATION,help='how long to wait when downloading a tree given as an http or https URL'"`
+}
+
+func (c *baselineSaveCmd) Run(kctx *kong.Context) error {
+	d := &differ{
+		IgnorePermissionError: !c.PermissionsErrors,
+		FetchTimeout:          c.Timeout,
+	}
+	tree := c.Tree
+	var err error
+	if !isURL(tree) {
+		tree, err = absPath(tree)
+		if err != nil {
+			return err
+		}
+	}
+	fsys, err := d.getFS(tree)
+	if err != nil {
+		return err
+	}
+	snap, err := d.plSnapshot(fsys)
+	if err != nil {
+		return err
+	}
+	filename, err := baselineFile(c.Name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0o700)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = writeSnapshot(file, tree, snap)
+	if err != nil {
+		_ = file.Close() //nolint:errcheck // already returning an error
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(kctx.Stderr, "saved baseline %s of %s\n", c.Name, tree)
+	return nil
+}
+
+type baselineDiffCmd struct {
+	Name string `kong:"arg,help='name of the baseline'"`
+	Tree string `kong:"arg,optional,help='directory tree (or file) to compare to the baseline. defaults to the tree the baseline was saved from'"`
+	compareOptions
+}
+
+func (c *baselineDiffCmd) Run(kctx *kong.Context) error {
+	d, err := c.differ(kctx.Stderr)
+	if err != nil {
+		return err
+	}
+	snap, sf, err := loadBaseline(c.Name)
+	if err != nil {
+		return err
+	}
+	tree := c.Tree
+	if tree == "" {
+		tree = sf.Tree
+	}
+	fsys, err := d.getFS(tree)
+	if err != nil {
+		return err
+	}
+	_, diff, err := d.diffFS(snap, fsys)
+	if err != nil {
+		return err
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return c.formatter().write(newOutputWriter(kctx.Stdout, c.OutputEncoding), diff)
+}
+
+type baselineListCmd struct{}
+
+func (c *baselineListCmd) Run(kctx *kong.Context) error {
+	dir, err := baselineDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), baselineExt) {
+			names = append(names, strings.TrimSuffix(entry.Name(), baselineExt))
+		}
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(kctx.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		_, sf, err := loadBaseline(name)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t%v\t\n", name, err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, sf.Created.Format(time.RFC3339), sf.Tree)
+	}
+	return tw.Flush()
+}
+
+type baselineRmCmd struct {
+	Name string `kong:"arg,help='name of the baseline'"`
+}
+
+func (c *baselineRmCmd) Run() error {
+	filename, err := baselineFile(c.Name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no baseline named %s", c.Name)
+	}
+	return err
+}
+
+const baselineExt = ".snapshot"
+
+// baselineDir is where named baselines are stored
+func baselineDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "plist-diff", "baselines"), nil
+}
+
+func baselineFile(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid baseline name %q", name)
+	}
+	dir, err := baselineDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+baselineExt), nil
+}
+
+func loadBaseline(name string) (*memFS, *snapshotFile, error) {
+	filename, err := baselineFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("no baseline named %s", name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close() //nolint:errcheck // only reading
+	return readSnapshot(file)
+}
+
+// absPath expands path with expandPath and makes it absolute.
+func absPath(path string) (string, error) {
+	path, err := expandPath(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
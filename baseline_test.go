@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// runBaseline runs plist-diff with args and returns stdout and stderr. It fails the test when the
+// exit code isn't wantCode.
+func runBaseline(t *testing.T, wantCode int, args ...string) (string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	if code != wantCode {
+		t.Fatalf("%v: exit code %d, want %d. stderr: %s", args, code, wantCode, stderr.String())
+	}
+	return stdout.String(), stderr.String()
+}
+
+func TestBaseline(t *testing.T) {
+	// os.UserConfigDir uses XDG_CONFIG_HOME on linux and HOME elsewhere
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("HOME", config)
+	dir := watchTree(t, "watch/a")
+
+	_, stderr := runBaseline(t, 0, "baseline", "save", "test", dir)
+	if diff := cmp.Diff("saved baseline test of "+dir+"\n", stderr); diff != "" {
+		t.Errorf("save stderr (-want +got):\n%s", diff)
+	}
+
+	copyTree(t, "watch/b", dir)
+	err := os.WriteFile(filepath.Join(dir, "broken.plist"), []byte("not a plist"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := runBaseline(t, 0, "baseline", "diff", "test")
+	want := `broken.plist:
+	-root: <missing>
+	+root: <unparseable>
+
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`
+	if diff := cmp.Diff(want, stdout); diff != "" {
+		t.Errorf("diff stdout (-want +got):\n%s", diff)
+	}
+	// warnings go to the command's stderr
+	if diff := cmp.Diff("warning: broken.plist could not be parsed as a plist\n", stderr); diff != "" {
+		t.Errorf("diff stderr (-want +got):\n%s", diff)
+	}
+
+	stdout, _ = runBaseline(t, 0, "baseline", "list")
+	if diff := cmp.Diff("test  TIME  "+dir+"\n", timestamp.ReplaceAllString(stdout, "TIME")); diff != "" {
+		t.Errorf("list stdout (-want +got):\n%s", diff)
+	}
+
+	runBaseline(t, 0, "baseline", "rm", "test")
+	stdout, _ = runBaseline(t, 0, "baseline", "list")
+	if stdout != "" {
+		t.Errorf("baseline still listed after rm:\n%s", stdout)
+	}
+	_, stderr = runBaseline(t, 1, "baseline", "rm", "test")
+	if !strings.HasSuffix(stderr, "error: no baseline named test\n") {
+		t.Errorf("second rm stderr is %q, want a no baseline error", stderr)
+	}
+}
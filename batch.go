@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+type batchCmd struct {
+	Manifest string `kong:"arg,type=existingfile,help='plist file with an array of dicts with a and b trees to compare and an optional label'"`
+	JSON     bool   `kong:"help='output the combined report as a single JSON document'"`
+	compareOptions
+}
+
+// batchPair is one comparison from a batch manifest
+type batchPair struct {
+	label string
+	a     string
+	b     string
+}
+
+type jsonBatch struct {
+	Pairs    []jsonBatchPair `json:"pairs"`
+	Total    int             `json:"total"`
+	Differed int             `json:"differed"`
+}
+
+type jsonBatchPair struct {
+	Label string          `json:"label"`
+	A     string          `json:"a"`
+	B     string          `json:"b"`
+	Equal bool            `json:"equal"`
+	Files []jsonBatchFile `json:"files,omitempty"`
+}
+
+type jsonBatchFile struct {
+	File  string     `json:"file"`
+	Diffs []jsonDiff `json:"diffs"`
+}
+
+// Run compares each pair in the manifest and writes a report with a section per pair followed by a
+// summary of the pairs that differed.
+func (c *batchCmd) Run(kctx *kong.Context) error {
+	pairs, err := readBatchManifest(c.Manifest)
+	if err != nil {
+		return err
+	}
+	d, err := c.differ(kctx.Stderr)
+	if err != nil {
+		return err
+	}
+	f := c.formatter()
+	diffs := make([]fsDiff, len(pairs))
+	for i, pair := range pairs {
+		_, diffs[i], err = d.diff(pair.a, pair.b)
+		if err != nil {
+			return fmt.Errorf("%s: %v", pair.label, err)
+		}
+	}
+	out := newOutputWriter(kctx.Stdout, c.OutputEncoding)
+	if c.JSON {
+		return writeBatchJSON(out, f, pairs, diffs)
+	}
+	_, err = io.WriteString(out, f.batch(pairs, diffs))
+	return err
+}
+
+// readBatchManifest reads a plist array of dicts with a, b and label keys. Relative trees are
+// relative to the manifest's directory. The label defaults to "a vs b".
+func readBatchManifest(filename string) ([]batchPair, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array of dicts with a, b and label keys", filename)
+	}
+	dir := filepath.Dir(filename)
+	pairs := make([]batchPair, len(list))
+	for i, v := range list {
+		dict, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: item %d must be a dict with a, b and label keys", filename, i)
+		}
+		a, _ := dict["a"].(string)
+		b, _ := dict["b"].(string)
+		if a == "" || b == "" {
+			return nil, fmt.Errorf("%s: item %d must have a and b strings", filename, i)
+		}
+		label, _ := dict["label"].(string)
+		if label == "" {
+			label = a + " vs " + b
+		}
+		pairs[i] = batchPair{
+			label: label,
+			a:     manifestPath(dir, a),
+			b:     manifestPath(dir, b),
+		}
+	}
+	return pairs, nil
+}
+
+// manifestPath resolves a tree from a manifest in dir
+func manifestPath(dir, tree string) string {
+	if isURL(tree) || filepath.IsAbs(tree) {
+		return tree
+	}
+	return filepath.Join(dir, tree)
+}
+
+// batch renders a section for each pair followed by a summary
+func (f *formatter) batch(pairs []batchPair, diffs []fsDiff) string {
+	var s string
+	var differed []string
+	for i, pair := range pairs {
+		s += fmt.Sprintf("== %s ==\n", pair.label)
+		if diffs[i].changes() == 0 {
+			s += "no changes\n\n"
+			continue
+		}
+		differed = append(differed, pair.label)
+		s += f.format(diffs[i]) + "\n"
+	}
+	s += fmt.Sprintf("%d of %d pairs differed", len(differed), len(pairs))
+	if len(differed) > 0 {
+		s += ": " + strings.Join(differed, ", ")
+	}
+	return s + "\n"
+}
+
+func writeBatchJSON(w io.Writer, f *formatter, pairs []batchPair, diffs []fsDiff) error {
+	report := jsonBatch{
+		Pairs: make([]jsonBatchPair, len(pairs)),
+		Total: len(pairs),
+	}
+	for i, pair := range pairs {
+		p := jsonBatchPair{
+			Label: pair.label,
+			A:     pair.a,
+			B:     pair.b,
+			Equal: diffs[i].changes() == 0,
+		}
+		if !p.Equal {
+			report.Differed++
+		}
+		for _, filename := range f.filenames(diffs[i]) {
+			p.Files = append(p.Files, jsonBatchFile{
+				File:  filename,
+				Diffs: f.jsonDiffs(diffs[i][filename]),
+			})
+		}
+		report.Pairs[i] = p
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&report)
+}
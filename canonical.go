@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"howett.net/plist"
+)
+
+type canonicalizeCmd struct {
+	File   string `kong:"arg,type=existingfile,help='plist file to canonicalize'"`
+	Format string `kong:"enum='xml,binary,openstep',default=xml,help='format to write. one of xml, binary or openstep. openstep has no numbers, booleans or dates so they are written as strings'"`
+}
+
+// Run writes the canonical form of File to stdout.
+func (c *canonicalizeCmd) Run(kctx *kong.Context) error {
+	filename, err := expandPath(c.File)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	out, err := canonicalPlist(data, plistFormats[c.Format], decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return fmt.Errorf("%s: %v", c.File, err)
+	}
+	_, err = kctx.Stdout.Write(out)
+	return err
+}
+
+// canonicalPlist decodes data with do and encodes it again in format with dict keys sorted and tab
+// indentation, so plists with the same values have the same bytes. Text formats end with a newline.
+func canonicalPlist(data []byte, format int, do decodeOptions) ([]byte, error) {
+	val, _, err := decodePlist(data, do)
+	if err != nil {
+		return nil, err
+	}
+	if format == plist.BinaryFormat {
+		return plist.Marshal(val, format)
+	}
+	out, err := plist.MarshalIndent(val, format, "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// canonicalData is the canonical XML form of data, or data itself when it is missing or can't be
+// decoded.
+func (d *differ) canonicalData(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	out, err := canonicalPlist(data, plist.XMLFormat, decodeOptions{format: d.AssumeFormat, maxDepth: d.MaxNesting})
+	if err != nil {
+		return data
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// compactEscaper escapes the characters that would split a compact field or line
+var compactEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// compact renders each diff on its own line as tab separated filename, path, old value and new
+// value. Dicts and arrays are written as JSON and missing values and files are empty.
+func (f *formatter) compact(diff fsDiff) string {
+	var s string
+	for _, filename := range f.filenames(diff) {
+		for i := range diff[filename] {
+			d := &diff[filename][i]
+			old := d.old
+			if d.equal {
+				old = d.new
+			}
+			fields := []string{filename, f.diffPath(d), f.compactValue(old), f.compactValue(d.new)}
+			for j := range fields {
+				fields[j] = compactEscaper.Replace(fields[j])
+			}
+			s += strings.Join(fields, "\t") + "\n"
+		}
+	}
+	return s
+}
+
+func (f *formatter) compactValue(v interface{}) string {
+	if v == nil || v == plistMissing {
+		return ""
+	}
+	if !isComposite(v) {
+		return f.value(v)
+	}
+	b, err := json.Marshal(jsonValue(v, &cycleGuard{}))
+	if err != nil {
+		// jsonValue only produces values that encoding/json can marshal
+		panic(err)
+	}
+	return string(b)
+}
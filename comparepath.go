@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// compare strategies for compareRule
+const (
+	strategyExact     = "exact"
+	strategyRounded   = "rounded"
+	strategyUnordered = "unordered"
+	strategyIgnore    = "ignore"
+	strategySemver    = "semver"
+)
+
+// compareRule sets how values at key paths matching pattern, and everything under them, are compared.
+type compareRule struct {
+	// pattern is a path.Match pattern for key paths like the ones for --numeric-threshold-path
+	pattern string
+	// strategy is one of strategyExact, strategyRounded, strategyUnordered, strategyIgnore or
+	// strategySemver
+	strategy string
+	// digits is the number of decimal places for strategyRounded
+	digits int
+}
+
+// parseCompareRule parses a rule written as PATH=STRATEGY.
+func parseCompareRule(s string) (compareRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 1 {
+		return compareRule{}, fmt.Errorf("invalid compare path %q: must be PATH=STRATEGY", s)
+	}
+	rule := compareRule{
+		pattern:  s[:i],
+		strategy: s[i+1:],
+	}
+	_, err := path.Match(rule.pattern, "")
+	if err != nil {
+		return compareRule{}, fmt.Errorf("invalid compare path %q: %v", s, err)
+	}
+	if strings.HasPrefix(rule.strategy, strategyRounded+":") {
+		rule.digits, err = strconv.Atoi(strings.TrimPrefix(rule.strategy, strategyRounded+":"))
+		if err != nil || rule.digits < 0 {
+			return compareRule{}, fmt.Errorf("invalid compare path %q: rounded needs a number of decimal places like rounded:3", s)
+		}
+		rule.strategy = strategyRounded
+	}
+	switch rule.strategy {
+	case strategyExact, strategyRounded, strategyUnordered, strategyIgnore, strategySemver:
+		return rule, nil
+	default:
+		return compareRule{}, fmt.Errorf("invalid compare path %q: unknown strategy %q", s, rule.strategy)
+	}
+}
+
+// matches is true when the key path of p or one of its parents matches the rule's pattern.
+func (r compareRule) matches(p cmp.Path) bool {
+	return matchKeyPathOrParent([]string{r.pattern}, pathKeys(p))
+}
+
+// option is the cmp.Option for the rule that applies where only is true. It is nil for strategyExact,
+// which uses the default comparison.
+func (r compareRule) option(only func(cmp.Path) bool) cmp.Option {
+	switch r.strategy {
+	case strategyIgnore:
+		return cmp.FilterPath(only, cmp.Ignore())
+	case strategyUnordered:
+		return cmp.FilterPath(only, cmpopts.SortSlices(func(a, b interface{}) bool {
+			as, bs := fmt.Sprintf("%T %s", a, formatValue(a)), fmt.Sprintf("%T %s", b, formatValue(b))
+			return as < bs
+		}))
+	case strategyRounded:
+		scale := math.Pow(10, float64(r.digits))
+		return cmp.FilterPath(only, cmp.FilterValues(func(x, y interface{}) bool {
+			_, xok := toFloat(x)
+			_, yok := toFloat(y)
+			return xok && yok
+		}, cmp.Comparer(func(x, y interface{}) bool {
+			xf, _ := toFloat(x)
+			yf, _ := toFloat(y)
+			return math.Round(xf*scale) == math.Round(yf*scale)
+		})))
+	case strategySemver:
+		// versions are only compared to note upgrades and downgrades, so any other difference in
+		// the strings is still a change
+		return cmp.FilterPath(only, cmp.Comparer(func(x, y string) bool {
+			return normalizeVersion(x) == normalizeVersion(y)
+		}))
+	default:
+		return nil
+	}
+}
+
+// firstRule returns the index of the first rule matching p or -1 when none do.
+func firstRule(rules []compareRule, p cmp.Path) int {
+	for i := range rules {
+		if rules[i].matches(p) {
+			return i
+		}
+	}
+	return -1
+}
+
+// compareRuleOptions returns the options for rules. Only the first rule matching a path applies to it.
+func compareRuleOptions(rules []compareRule) []cmp.Option {
+	var opts []cmp.Option
+	for i := range rules {
+		i := i
+		opt := rules[i].option(func(p cmp.Path) bool {
+			return firstRule(rules, p) == i
+		})
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// plistResolver sets flags from a plist config file. The file is a dict with flag names as keys, like
+// "ignore-key" or "timeout". Values can be strings, numbers or booleans, or arrays of them for flags
+// that may be repeated. Flags given on the command line take precedence.
+type plistResolver map[string]interface{}
+
+// plistConfig is a kong.ConfigurationLoader for plist config files
+func plistConfig(r io.Reader) (kong.Resolver, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	values, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config: must be a dict of flag names to values")
+	}
+	return plistResolver(values), nil
+}
+
+// Validate returns an error for keys that aren't flag names.
+func (r plistResolver) Validate(app *kong.Application) error {
+	flags := map[string]bool{}
+	addFlags(flags, app.Node)
+	var unknown []string
+	for key := range r {
+		if !flags[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("config: unknown flags: %s", strings.Join(unknown, ", "))
+}
+
+func addFlags(flags map[string]bool, node *kong.Node) {
+	for _, flag := range node.Flags {
+		flags[flag.Name] = true
+	}
+	for _, child := range node.Children {
+		addFlags(flags, child)
+	}
+}
+
+// Resolve returns the config value for flag.
+func (r plistResolver) Resolve(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (interface{}, error) {
+	val, ok := r[flag.Name]
+	if !ok {
+		return nil, nil
+	}
+	switch val := val.(type) {
+	case map[string]interface{}:
+		return nil, fmt.Errorf("config: %s can't be a dict", flag.Name)
+	case []interface{}:
+		// kong decodes arrays for repeatable flags from JSON-like values
+		items := make([]interface{}, len(val))
+		for i := range val {
+			items[i] = fmt.Sprint(val[i])
+		}
+		return items, nil
+	default:
+		return fmt.Sprint(val), nil
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// cycleGuard tracks the dicts and arrays a walk over a value is inside of so that it can stop at
+// cycles instead of recursing forever. Decoded plists never have cycles, but graphs built from them
+// can. The zero value is ready to use.
+type cycleGuard struct {
+	// open maps the dicts and arrays being walked to the number of keys leading to them
+	open map[uintptr]int
+	// keys are the dict keys and array indexes leading to the current value
+	keys []interface{}
+}
+
+// enter is called before walking the entries of v. It returns false along with a marker for the
+// cycle when v is already being walked. Otherwise leave must be called when the walk of v is done.
+func (g *cycleGuard) enter(v interface{}) (string, bool) {
+	id, ok := containerID(v)
+	if !ok {
+		return "", true
+	}
+	if n, seen := g.open[id]; seen {
+		return cycleMarker(g.keys[:n]), false
+	}
+	if g.open == nil {
+		g.open = map[uintptr]int{}
+	}
+	g.open[id] = len(g.keys)
+	return "", true
+}
+
+func (g *cycleGuard) leave(v interface{}) {
+	if id, ok := containerID(v); ok {
+		delete(g.open, id)
+	}
+}
+
+// push adds the key or index of the entry about to be walked.
+func (g *cycleGuard) push(key interface{}) {
+	g.keys = append(g.keys, key)
+}
+
+func (g *cycleGuard) pop() {
+	g.keys = g.keys[:len(g.keys)-1]
+}
+
+// containerID identifies a dict or non-empty array by the memory backing it. Empty arrays can't
+// contain themselves, so they aren't tracked.
+func containerID(v interface{}) (uintptr, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return reflect.ValueOf(v).Pointer(), true
+	case []interface{}:
+		if len(v) == 0 {
+			return 0, false
+		}
+		return reflect.ValueOf(v).Pointer(), true
+	default:
+		return 0, false
+	}
+}
+
+// cycleMarker renders a back-reference to the value at keys like <cycle→root.Foo[0]>
+func cycleMarker(keys []interface{}) string {
+	var b strings.Builder
+	b.WriteString("<cycle→root")
+	for _, key := range keys {
+		switch key := key.(type) {
+		case string:
+			b.WriteString("." + key)
+		case int:
+			b.WriteString("[" + strconv.Itoa(key) + "]")
+		}
+	}
+	b.WriteString(">")
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCycleMarker(t *testing.T) {
+	dict := map[string]interface{}{"Name": "x"}
+	dict["Self"] = dict
+	array := []interface{}{"x", nil}
+	array[1] = array
+	nested := map[string]interface{}{}
+	nested["Foo"] = []interface{}{nested}
+
+	t.Run("formatValue", func(t *testing.T) {
+		for _, td := range []struct {
+			name string
+			v    interface{}
+			want string
+		}{
+			{name: "dict", v: dict, want: "map[Name:x Self:<cycle→root>]"},
+			{name: "array", v: array, want: "[x <cycle→root>]"},
+			{name: "nested", v: nested, want: "map[Foo:[<cycle→root>]]"},
+			{name: "inner", v: map[string]interface{}{"Foo": array}, want: "map[Foo:[x <cycle→root.Foo>]]"},
+		} {
+			td := td
+			t.Run(td.name, func(t *testing.T) {
+				if got := formatValue(td.v); got != td.want {
+					t.Errorf("got %q, want %q", got, td.want)
+				}
+			})
+		}
+	})
+
+	t.Run("dump", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeDump(&buf, "root", map[string]interface{}{"Dict": dict, "Array": array}, &cycleGuard{}, plistType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `root: (Dict, 2 entries)
+  "Array": (Array, 2 items)
+    [0]: x (String)
+    [1]: <cycle→root.Array>
+  "Dict": (Dict, 2 entries)
+    "Name": x (String)
+    "Self": <cycle→root.Dict>
+`
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("dump (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		want := map[string]interface{}{"Name": "x", "Self": "<cycle→root>"}
+		if diff := cmp.Diff(want, jsonValue(dict, &cycleGuard{})); diff != "" {
+			t.Errorf("json (-want +got):\n%s", diff)
+		}
+	})
+}
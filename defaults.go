@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readDefaults reads a plist of default values for --defaults. It must be a dict.
+func readDefaults(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	dict, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a dict", filename)
+	}
+	return dict, nil
+}
+
+// dropDefaults removes the diffs where a dict key is added with or removed while holding the value
+// at the same key path in defaults.
+func dropDefaults(defaults map[string]interface{}, delta plistDiff) plistDiff {
+	var kept plistDiff
+	for _, d := range delta {
+		if !d.equal && isDefault(defaults, &d) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// isDefault is true when d adds or removes a dict key and the added or removed value is its default
+func isDefault(defaults map[string]interface{}, d *FileDiff) bool {
+	if !isDictKey(d.keys) {
+		return false
+	}
+	val := d.new
+	switch {
+	case d.old == nil:
+	case d.new == nil:
+		val = d.old
+	default:
+		return false
+	}
+	keys := make([]string, len(d.keys))
+	for i, key := range d.keys {
+		keys[i] = fmt.Sprint(key)
+	}
+	def, ok := lookupKeyPath(defaults, keys)
+	// cmp.Equal rather than reflect.DeepEqual so that dates are compared by instant
+	return ok && cmp.Equal(def, val)
+}
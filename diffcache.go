@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+)
+
+// diffCache keeps the diff of each file between a snapshot and a watched tree so that watch only
+// reads, decodes and compares the files that changed since the last tick. Files that are added or
+// removed have a new stamp, so they are always compared.
+type diffCache struct {
+	entries map[string]diffCacheEntry
+	// checksum adds a hash of the content to stamps. The modification time and size miss writes
+	// within the filesystem's timestamp resolution and files that are replaced with their old times,
+	// but hashing means reading every file on every tick.
+	checksum bool
+}
+
+// fileStamp is what a cached diff is valid for.
+type fileStamp struct {
+	exists bool
+	// modTime is in nanoseconds since the epoch so that stamps can be compared with ==
+	modTime int64
+	size    int64
+	// sum is only set when the cache has checksum
+	sum [sha256.Size]byte
+}
+
+type diffCacheEntry struct {
+	stamp fileStamp
+	diff  plistDiff
+}
+
+// newDiffCache returns a cache for watching tree. It is nil for URLs because their modification
+// times don't say whether they changed.
+func newDiffCache(tree string, checksum bool) *diffCache {
+	if isURL(tree) {
+		return nil
+	}
+	return &diffCache{
+		entries:  map[string]diffCacheEntry{},
+		checksum: checksum,
+	}
+}
+
+// diffFSFilename is d.diffFSFilename with the result cached by the stamp of filename in b. The
+// snapshot a doesn't change, so only b matters. A nil cache compares the file every time.
+func (c *diffCache) diffFSFilename(d *differ, a, b fs.FS, filename string) (plistDiff, error) {
+	if c == nil {
+		return d.diffFSFilename(a, b, filename)
+	}
+	stamp, err := statStamp(b, filename)
+	if err != nil {
+		// let diffFSFilename deal with the error
+		return d.diffFSFilename(a, b, filename)
+	}
+	var bData []byte
+	if c.checksum {
+		// the content is read once for both the hash and the diff
+		bData, err = d.readFile(b, filename)
+		if err != nil {
+			return nil, err
+		}
+		stamp.sum = sha256.Sum256(bData)
+	}
+	if entry, ok := c.entries[filename]; ok && entry.stamp == stamp {
+		return entry.diff, nil
+	}
+	if !c.checksum {
+		bData, err = d.readFile(b, filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+	diff, err := d.diffFSData(a, b, filename, bData)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[filename] = diffCacheEntry{
+		stamp: stamp,
+		diff:  diff,
+	}
+	return diff, nil
+}
+
+// statStamp returns the stamp of filename in fsys without its sum. Files that don't exist have the
+// zero stamp.
+func statStamp(fsys fs.FS, filename string) (fileStamp, error) {
+	info, err := fs.Stat(fsys, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileStamp{}, nil
+	}
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{
+		exists:  true,
+		modTime: info.ModTime().UnixNano(),
+		size:    info.Size(),
+	}, nil
+}
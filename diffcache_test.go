@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffCacheSameModTime(t *testing.T) {
+	mtime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := fstest.MapFS{
+		"a.plist": {Data: []byte(`<plist version="1.0"><string>1</string></plist>`), ModTime: mtime},
+	}
+	live := fstest.MapFS{
+		"a.plist": {Data: []byte(`<plist version="1.0"><string>1</string></plist>`), ModTime: mtime},
+	}
+	d := &differ{}
+	cache := newDiffCache("tree", true)
+	eq, _, err := d.diffFSCached(snap, live, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eq {
+		t.Fatal("expected no changes")
+	}
+	// same size and modification time, different content
+	live["a.plist"] = &fstest.MapFile{Data: []byte(`<plist version="1.0"><string>2</string></plist>`), ModTime: mtime}
+	eq, diff, err := d.diffFSCached(snap, live, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eq {
+		t.Error("change with the same modification time and size wasn't detected")
+	}
+	if got := diff["a.plist"].changes(); got != 1 {
+		t.Errorf("expected 1 change, got %d:\n%s", got, diff)
+	}
+}
+
+// countingFS counts the files read from a MapFS. Stat doesn't read files.
+type countingFS struct {
+	fstest.MapFS
+	opened map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opened[name]++
+	return c.MapFS.Open(name)
+}
+
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	c.opened[name]++
+	return c.MapFS.ReadFile(name)
+}
+
+func TestDiffCacheReads(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		checksum := checksum
+		t.Run(fmt.Sprintf("checksum=%t", checksum), func(t *testing.T) {
+			snap := syntheticTree(3, 0)
+			live := &countingFS{MapFS: syntheticTree(3, 0), opened: map[string]int{}}
+			d := &differ{}
+			cache := newDiffCache("tree", checksum)
+			tick := func(want map[string]int) {
+				t.Helper()
+				live.opened = map[string]int{}
+				_, _, err := d.diffFSCached(snap, live, cache)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(want, live.opened); diff != "" {
+					t.Errorf("files opened (-want +got):\n%s", diff)
+				}
+			}
+			all := map[string]int{"dir0/file0.plist": 1, "dir1/file1.plist": 1, "dir2/file2.plist": 1}
+			tick(all)
+			live.MapFS["dir1/file1.plist"] = &fstest.MapFile{Data: syntheticPlist(50, 1), ModTime: time.Unix(1, 0)}
+			if checksum {
+				// every file is hashed, but the changed one is still only read once
+				tick(all)
+				return
+			}
+			tick(map[string]int{"dir1/file1.plist": 1})
+			tick(map[string]int{})
+		})
+	}
+}
+
+// BenchmarkWatchTick is a watch tick on a tree where one file changes between ticks. full compares
+// every file each tick like watch without a cache.
+func BenchmarkWatchTick(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		for _, mode := range []string{"full", "cached", "checksum"} {
+			snap, live := syntheticTree(size, 0), syntheticTree(size, 0)
+			b.Run(fmt.Sprintf("files=%d/%s", size, mode), func(b *testing.B) {
+				d := &differ{}
+				var cache *diffCache
+				if mode != "full" {
+					cache = newDiffCache("tree", mode == "checksum")
+				}
+				names := make([]string, 0, len(live))
+				for name := range live {
+					names = append(names, name)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					live[names[i%len(names)]] = &fstest.MapFile{Data: syntheticPlist(50, i+1), ModTime: time.Unix(int64(i+1), 0)}
+					_, _, err := d.diffFSCached(snap, live, cache)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
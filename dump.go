@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"howett.net/plist"
+)
+
+type dumpCmd struct {
+	File       string `kong:"arg,type=existingfile,help='plist file to decode'"`
+	PlistTypes bool   `kong:"help='show plist type names like Integer instead of Go types like uint64'"`
+}
+
+// Run decodes File and writes the decoded values as an indented tree with their types.
+func (c *dumpCmd) Run(kctx *kong.Context) error {
+	filename, err := expandPath(c.File)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	val, format, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return fmt.Errorf("%s: %v", c.File, err)
+	}
+	typeName := func(v interface{}) string {
+		return fmt.Sprintf("%T", v)
+	}
+	if c.PlistTypes {
+		typeName = plistType
+	}
+	_, err = fmt.Fprintf(kctx.Stdout, "format: %s\n", plist.FormatNames[format])
+	if err != nil {
+		return err
+	}
+	return writeDump(kctx.Stdout, "root", val, &cycleGuard{}, typeName)
+}
+
+// writeDump writes v named name indented for its depth in guard, followed by the entries of dicts
+// and arrays one level deeper. A dict or array that contains itself is written as a cycle marker.
+func writeDump(w io.Writer, name string, v interface{}, guard *cycleGuard, typeName func(interface{}) string) error {
+	indent := strings.Repeat("  ", len(guard.keys))
+	marker, ok := guard.enter(v)
+	if !ok {
+		_, err := fmt.Fprintf(w, "%s%s: %s\n", indent, name, marker)
+		return err
+	}
+	defer guard.leave(v)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		_, err := fmt.Fprintf(w, "%s%s: (%s, %d entries)\n", indent, name, typeName(v), len(v))
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			guard.push(key)
+			err = writeDump(w, fmt.Sprintf("%q", key), v[key], guard, typeName)
+			guard.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		_, err := fmt.Fprintf(w, "%s%s: (%s, %d items)\n", indent, name, typeName(v), len(v))
+		if err != nil {
+			return err
+		}
+		for i := range v {
+			guard.push(i)
+			err = writeDump(w, fmt.Sprintf("[%d]", i), v[i], guard, typeName)
+			guard.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		_, err := fmt.Fprintf(w, "%s%s: %s (%s)\n", indent, name, formatValue(v), typeName(v))
+		return err
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var xmlEncodingRegexp = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding=["']([^"']+)["']`)
+
+// encodingMismatch is an XML plist that declares one encoding but contains bytes in another
+type encodingMismatch struct {
+	filename string
+	declared string
+	detected string
+}
+
+// checkEncoding compares the encoding declared by an XML plist with the encoding its bytes are in.
+// It returns nil for data that isn't XML or is consistent with its declared encoding.
+func checkEncoding(filename string, data []byte) *encodingMismatch {
+	if bytes.HasPrefix(data, []byte("bplist")) || !bytes.Contains(data, []byte("<plist")) {
+		return nil
+	}
+	declared := "UTF-8"
+	if m := xmlEncodingRegexp.FindSubmatch(data); m != nil {
+		declared = string(m[1])
+	}
+	detected := detectEncoding(data)
+	if encodingCompatible(declared, detected) {
+		return nil
+	}
+	return &encodingMismatch{
+		filename: filename,
+		declared: declared,
+		detected: detected,
+	}
+}
+
+// detectEncoding makes a best guess at the encoding of data. It is one of US-ASCII, UTF-8, UTF-16
+// or ISO-8859-1.
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}), bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return "UTF-16"
+	case isASCII(data):
+		return "US-ASCII"
+	case utf8.Valid(data):
+		return "UTF-8"
+	default:
+		return "ISO-8859-1"
+	}
+}
+
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func encodingCompatible(declared, detected string) bool {
+	declared = strings.ToUpper(declared)
+	switch detected {
+	case "US-ASCII":
+		// ASCII is valid in every encoding we detect except UTF-16
+		return !strings.HasPrefix(declared, "UTF-16")
+	case "UTF-8":
+		return declared == "UTF-8" || declared == "UTF8"
+	case "UTF-16":
+		return strings.HasPrefix(declared, "UTF-16")
+	default:
+		return declared != "UTF-8" && declared != "UTF8" && declared != "US-ASCII" && !strings.HasPrefix(declared, "UTF-16")
+	}
+}
+
+// encodingMismatches returns the files in fsys that don't match their declared encoding.
+func (d *differ) encodingMismatches(fsys fs.FS) ([]encodingMismatch, error) {
+	files, err := d.getPlistFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []encodingMismatch
+	for filename := range files {
+		var data []byte
+		data, err = d.readFile(fsys, filename)
+		if err != nil {
+			return nil, err
+		}
+		if m := checkEncoding(filename, data); m != nil {
+			mismatches = append(mismatches, *m)
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].filename < mismatches[j].filename
+	})
+	return mismatches, nil
+}
+
+// reportEncodings writes the encoding mismatches in each of the trees to w.
+func (d *differ) reportEncodings(w io.Writer, trees ...string) error {
+	for _, tree := range trees {
+		fsys, err := d.getFS(tree)
+		if err != nil {
+			return err
+		}
+		mismatches, err := d.encodingMismatches(fsys)
+		if err != nil {
+			return err
+		}
+		for _, m := range mismatches {
+			_, err = fmt.Fprintf(w, "%s: %s declares %s encoding but looks like %s\n", tree, m.filename, m.declared, m.detected)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
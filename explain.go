@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// explain writes why each file in trees a and b is or isn't compared and, for compared files,
+// which changes are reported and which option left out each of the others.
+func (d *differ) explain(w io.Writer, f *formatter, a, b string) error {
+	trees, err := d.getFSs(a, b)
+	if err != nil {
+		return err
+	}
+	aFS, bFS := trees[0], trees[1]
+	aFiles, err := d.explainWalk(aFS)
+	if err != nil {
+		return err
+	}
+	bFiles, err := d.explainWalk(bFS)
+	if err != nil {
+		return err
+	}
+	for _, filename := range unionNames(aFiles, bFiles) {
+		dir, inA := aFiles[filename]
+		if !inA {
+			dir = bFiles[filename]
+		}
+		_, inB := bFiles[filename]
+		err = d.explainFileTo(w, f, aFS, bFS, filename, dir, inA && inB)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unionNames returns the sorted names that are in either a or b
+func unionNames(a, b map[string]fs.DirEntry) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// explainFileTo writes the explanation of filename and, when it is compared, of its changes.
+func (d *differ) explainFileTo(w io.Writer, f *formatter, a, b fs.FS, filename string, dir fs.DirEntry, inBoth bool) error {
+	reason, ok, err := d.explainFile(a, b, filename, dir, inBoth)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err = fmt.Fprintf(w, "%s: skipped, %s\n", filename, reason)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s: compared, %s\n", filename, reason)
+	if err != nil {
+		return err
+	}
+	lines, err := d.explainDiffs(f, a, b, filename)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		_, err = fmt.Fprintf(w, "\t%s\n", line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// explainWalk returns the regular files in fsys whether or not they would be compared
+func (d *differ) explainWalk(fsys fs.FS) (map[string]fs.DirEntry, error) {
+	files := map[string]fs.DirEntry{}
+	err := fs.WalkDir(fsys, ".", func(path string, dir fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrPermission) && d.IgnorePermissionError && path != "." {
+			if dir != nil && dir.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if dir.Type().IsRegular() {
+			files[path] = dir
+		}
+		return nil
+	})
+	return files, err
+}
+
+// explainFile returns whether filename is compared and why. inBoth is true when it is in both trees.
+func (d *differ) explainFile(a, b fs.FS, filename string, dir fs.DirEntry, inBoth bool) (string, bool, error) {
+	if d.SkipFiles[dir.Name()] {
+		return "--skip-file " + dir.Name(), false, nil
+	}
+	reason := "it has a .plist extension"
+	switch {
+	case len(d.Files) > 0:
+		if !d.Files[filename] {
+			return "not listed by --files-from", false, nil
+		}
+		reason = "listed by --files-from"
+	case d.FileFilter != nil:
+		ok, err := d.includeFile(filename, dir)
+		if err != nil {
+			return "", false, err
+		}
+		if !ok {
+			return "excluded by the file filter", false, nil
+		}
+		reason = "included by the file filter"
+	case !isPlistFile(filename, nil):
+		return "not a .plist file", false, nil
+	}
+	if d.Intersection && !inBoth {
+		return "only in one tree with --intersection", false, nil
+	}
+	if len(d.WhereKey) > 0 {
+		aData, err := d.readFile(a, filename)
+		if err != nil {
+			return "", false, err
+		}
+		bData, err := d.readFile(b, filename)
+		if err != nil {
+			return "", false, err
+		}
+		if aData == nil && bData == nil {
+			return "--where-key " + strings.Join(d.WhereKey, ".") + " is in neither tree", false, nil
+		}
+	}
+	return reason, true, nil
+}
+
+// explainDiffs compares filename with and without the options that leave out changes and returns
+// a line for each change saying whether it is reported or what left it out.
+func (d *differ) explainDiffs(f *formatter, a, b fs.FS, filename string) ([]string, error) {
+	reported, err := d.diffFSFilename(a, b, filename)
+	if err != nil {
+		return nil, err
+	}
+	raw := *d
+	raw.IgnoreTimestamps = false
+	raw.IgnoreKeys = nil
+	raw.IgnoreRules = nil
+	raw.ReferencePaths = nil
+	raw.Defaults = nil
+	raw.IgnoreEmptyChanges = false
+	raw.AbsentBoolFalse = false
+	raw.CounterWindow = 0
+	raw.SkipLargeData = 0
+	raw.NumericThreshold = 0
+	raw.IgnoreUUIDs = false
+	raw.CompareRules = nil
+	raw.TransformRules = nil
+	raw.CoerceSingletons = false
+	raw.ShowEqual = false
+	raw.Context = 0
+	all, err := raw.diffFSFilename(a, b, filename)
+	if err != nil {
+		return nil, err
+	}
+	isReported := map[string]bool{}
+	for i := range reported {
+		if !reported[i].equal && reported[i].keys != nil {
+			isReported[reported[i].path] = true
+		}
+	}
+	var lines []string
+	seen := map[string]bool{}
+	for i := range all {
+		fd := &all[i]
+		if fd.equal || fd.keys == nil {
+			continue
+		}
+		seen[fd.path] = true
+		if isReported[fd.path] {
+			lines = append(lines, "reported "+f.diffPath(fd))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("ignored %s: %s", f.diffPath(fd), d.explainIgnored(filename, fd)))
+	}
+	for i := range reported {
+		fd := &reported[i]
+		if !fd.equal && fd.keys != nil && !seen[fd.path] {
+			lines = append(lines, "reported "+f.diffPath(fd))
+		}
+	}
+	return lines, nil
+}
+
+// explainIgnored names the option that left fd out of the diffs of filename.
+func (d *differ) explainIgnored(filename string, fd *FileDiff) string {
+	for _, explain := range ignoreExplainers {
+		if reason := explain(d, filename, fd); reason != "" {
+			return reason
+		}
+	}
+	return "equal with the comparison options like --numeric-threshold, --skip-large-data, --ignore-uuids, --compare-path, --transform-path or --coerce-singletons"
+}
+
+// ignoreExplainers are the checks explainIgnored tries in order. Each returns the option that left
+// out a diff or "" when it didn't.
+var ignoreExplainers = []func(d *differ, filename string, fd *FileDiff) string{
+	(*differ).explainIgnoredTimestamp,
+	(*differ).explainIgnoredKey,
+	(*differ).explainIgnoreRules,
+	(*differ).explainReference,
+	(*differ).explainDefaults,
+	(*differ).explainEmptyChange,
+	(*differ).explainAbsentFalse,
+	(*differ).explainCounter,
+}
+
+func (d *differ) explainIgnoredTimestamp(_ string, fd *FileDiff) string {
+	if !d.IgnoreTimestamps {
+		return ""
+	}
+	_, oldTime := fd.old.(time.Time)
+	_, newTime := fd.new.(time.Time)
+	if oldTime || newTime {
+		return "dates are ignored without --timestamps"
+	}
+	return ""
+}
+
+func (d *differ) explainIgnoredKey(_ string, fd *FileDiff) string {
+	for _, key := range fd.keys {
+		for _, ignored := range d.IgnoreKeys {
+			if key == ignored {
+				return "--ignore-key " + ignored
+			}
+		}
+	}
+	return ""
+}
+
+func (d *differ) explainIgnoreRules(filename string, fd *FileDiff) string {
+	for i := range d.IgnoreRules {
+		rule := &d.IgnoreRules[i]
+		if !rule.matchesFile(filename) {
+			continue
+		}
+		for _, pattern := range rule.paths {
+			if matchKeyPathOrParent([]string{pattern}, fd.keys) {
+				return fmt.Sprintf("--ignore-rules %s: %s", rule.files, pattern)
+			}
+		}
+	}
+	return ""
+}
+
+func (d *differ) explainReference(_ string, fd *FileDiff) string {
+	if len(d.ReferencePaths) > 0 && !referenced(d.ReferencePaths, fd) {
+		return "not in --reference"
+	}
+	return ""
+}
+
+func (d *differ) explainDefaults(_ string, fd *FileDiff) string {
+	if d.Defaults != nil && isDefault(d.Defaults, fd) {
+		return "default value in --defaults"
+	}
+	return ""
+}
+
+func (d *differ) explainEmptyChange(_ string, fd *FileDiff) string {
+	if d.IgnoreEmptyChanges && isEmpty(fd.old) && isEmpty(fd.new) {
+		return "--ignore-empty-changes"
+	}
+	return ""
+}
+
+func (d *differ) explainAbsentFalse(_ string, fd *FileDiff) string {
+	if d.AbsentBoolFalse && isDictKey(fd.keys) && (fd.old == nil && fd.new == false || fd.old == false && fd.new == nil) {
+		return "--absent-bool-false"
+	}
+	return ""
+}
+
+func (d *differ) explainCounter(_ string, fd *FileDiff) string {
+	if d.CounterWindow > 0 && isCounterBump(fd.old, fd.new, d.CounterWindow) {
+		return "--ignore-counters"
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--explain", "--skip-file", "skipped.plist", "--ignore-key", "LastOpened", "testdata/explain/a", "testdata/explain/b"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	want := `prefs.plist: compared, it has a .plist extension
+	ignored root["LastOpened"]: --ignore-key LastOpened
+	reported root["Name"]
+skipped.plist: skipped, --skip-file skipped.plist
+`
+	if got := stdout.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
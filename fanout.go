@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fanoutCmd struct {
+	File       string   `kong:"required,placeholder=NAME,help='relative path of the plist to compare under each root like com.apple.dock.plist'"`
+	Roots      []string `kong:"arg,name='root',help='directories to find the file in like /Users/*/Library/Preferences. quoted globs are expanded'"`
+	Timestamps bool     `kong:"help='include timestamp data in diffs. timestamps are ignored by default'"`
+	IgnoreKey  []string `kong:"sep=none,placeholder=NAME,help='ignore dict entries with this key wherever they appear. may be repeated'"`
+}
+
+// fanoutValue is the distinct value at a key path and the roots that have it
+type fanoutValue struct {
+	value  interface{}
+	ok     bool
+	labels []string
+}
+
+// Run compares File under each of Roots and writes the key paths where the values differ along
+// with each distinct value and the roots that have it. Timestamps and ignored keys are left out like
+// they are by diff.
+func (c *fanoutCmd) Run(kctx *kong.Context) error {
+	roots, err := expandRoots(c.Roots)
+	if err != nil {
+		return err
+	}
+	if len(roots) < 2 {
+		return fmt.Errorf("fanout needs at least two roots, found %d", len(roots))
+	}
+	d := &differ{
+		IgnoreTimestamps: !c.Timestamps,
+		IgnoreKeys:       c.IgnoreKey,
+	}
+	labels := rootLabels(roots)
+	var found []string
+	leaves := map[string]map[string]interface{}{}
+	for i, root := range roots {
+		filename := filepath.Join(root, filepath.FromSlash(c.File))
+		data, err := os.ReadFile(filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			_, err = fmt.Fprintf(kctx.Stdout, "%s: %s\n", labels[i], plistMissing)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+		if err != nil {
+			_, err = fmt.Fprintf(kctx.Stdout, "%s: %s\n", labels[i], plistUnparseable)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		found = append(found, labels[i])
+		leaves[labels[i]] = map[string]interface{}{}
+		d.fanoutLeaves(leaves[labels[i]], "root", val)
+	}
+	return writeFanout(kctx.Stdout, found, leaves, d.cmpOptions())
+}
+
+// expandRoots expands ~, environment variables and globs in roots. Roots that aren't globs are kept
+// whether or not they exist.
+func expandRoots(roots []string) ([]string, error) {
+	var expanded []string
+	for _, pattern := range roots {
+		root, err := expandPath(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !isGlob(root) {
+			expanded = append(expanded, root)
+			continue
+		}
+		matches, err := filepath.Glob(root)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// rootLabels names each root by the first path element that differs between them, like the user
+// name in /Users/NAME/Library/Preferences. Roots are named by their full paths when that element
+// doesn't tell them apart.
+func rootLabels(roots []string) []string {
+	elems := make([][]string, len(roots))
+	shortest := -1
+	for i, root := range roots {
+		elems[i] = strings.Split(filepath.ToSlash(filepath.Clean(root)), "/")
+		if shortest < 0 || len(elems[i]) < shortest {
+			shortest = len(elems[i])
+		}
+	}
+	labels := make([]string, len(roots))
+	for n := 0; n < shortest; n++ {
+		differs := false
+		for i := range elems {
+			labels[i] = elems[i][n]
+			differs = differs || labels[i] != labels[0]
+		}
+		if !differs {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, label := range labels {
+			if seen[label] {
+				break
+			}
+			seen[label] = true
+		}
+		if len(seen) == len(labels) {
+			return labels
+		}
+		break
+	}
+	copy(labels, roots)
+	return labels
+}
+
+// fanoutLeaves adds the values in v to leaves by key path. Dicts are followed down to their entries
+// and everything else, including arrays, is a single value. Entries with keys in d.IgnoreKeys and
+// dates when d.IgnoreTimestamps is set are left out, since they are no longer inside the dicts that
+// d.cmpOptions ignores them in.
+func (d *differ) fanoutLeaves(leaves map[string]interface{}, keyPath string, v interface{}) {
+	if _, ok := v.(time.Time); ok && d.IgnoreTimestamps {
+		return
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok || len(dict) == 0 {
+		leaves[keyPath] = v
+		return
+	}
+	for key, val := range dict {
+		if stringsContain(d.IgnoreKeys, key) {
+			continue
+		}
+		d.fanoutLeaves(leaves, fmt.Sprintf("%s[%q]", keyPath, key), val)
+	}
+}
+
+// stringsContain is true when list has s
+func stringsContain(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFanout writes each key path where the values in leaves aren't all the same according to opts,
+// followed by the distinct values and the labels that have them.
+func writeFanout(w io.Writer, labels []string, leaves map[string]map[string]interface{}, opts []cmp.Option) error {
+	keyPaths := map[string]bool{}
+	for _, label := range labels {
+		for keyPath := range leaves[label] {
+			keyPaths[keyPath] = true
+		}
+	}
+	sorted := make([]string, 0, len(keyPaths))
+	for keyPath := range keyPaths {
+		sorted = append(sorted, keyPath)
+	}
+	sort.Strings(sorted)
+	for _, keyPath := range sorted {
+		var values []*fanoutValue
+		for _, label := range labels {
+			val, ok := leaves[label][keyPath]
+			var match *fanoutValue
+			for _, fv := range values {
+				// cmp.Equal rather than reflect.DeepEqual so that dates are compared by instant
+				if fv.ok == ok && cmp.Equal(fv.value, val, opts...) {
+					match = fv
+					break
+				}
+			}
+			if match == nil {
+				match = &fanoutValue{value: val, ok: ok}
+				values = append(values, match)
+			}
+			match.labels = append(match.labels, label)
+		}
+		if len(values) < 2 {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s:\n", keyPath)
+		if err != nil {
+			return err
+		}
+		for _, fv := range values {
+			_, err = fmt.Fprintf(w, "\t%s: %s\n", keyValueText(fv.value, fv.ok), strings.Join(fv.labels, ", "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
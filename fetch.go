@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// isURL is true for http and https URLs
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchFS downloads the plist at url into a single-file fs.FS like the one getFS returns for a local
+// file, with the file named key. The Last-Modified header is used as the file's modification time
+// when there is one.
+func (d *differ) fetchFS(url, key string) (fs.FS, error) {
+	client := &http.Client{
+		Timeout: d.FetchTimeout,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // only reading
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	val := newMemFS()
+	err = val.WriteFile(key, data, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err == nil {
+		val.modTimes[key] = modTime
+	}
+	return val, nil
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	sortByName    = "name"
+	sortByChanges = "changes"
+)
+
+const (
+	formatText    = "text"
+	formatColumns = "columns"
+	formatJSONL   = "jsonl"
+	// formatPlistBuddy is a shell script of PlistBuddy commands
+	formatPlistBuddy = "plistbuddy"
+	// formatCompact is a tab separated line per diff
+	formatCompact = "compact"
+	// formatMobileConfig is a configuration profile that sets the changed keys
+	formatMobileConfig = "mobileconfig"
+	// formatOverlay is a plist of sparse patches for each file
+	formatOverlay = "overlay"
+)
+
+// defaultWidth is the output width for column layouts when the terminal width is unknown
+const defaultWidth = 80
+
+// formatter renders an fsDiff for output
+type formatter struct {
+	// Sort is either sortByName (the default) or sortByChanges
+	Sort string
+	// Format is formatText (the default), formatColumns, formatJSONL, formatPlistBuddy, formatCompact, formatMobileConfig or formatOverlay
+	Format string
+	// Width is the output width for formatColumns. Defaults to defaultWidth.
+	Width int
+	// Expand renders composite values in full in formatColumns instead of summarizing them.
+	Expand bool
+	// MaxValueLength is the number of runes scalar values are truncated to. 0 means no limit.
+	MaxValueLength int
+	// Dedup outputs diffs that are identical in several files once along with the list of files.
+	Dedup bool
+	// NameOnly outputs only the names of files with changes, one per line.
+	NameOnly bool
+	// Print0 ends each name from NameOnly with a NUL byte instead of a newline.
+	Print0 bool
+	// Stats outputs only the number of changes and values in each file with changes. The values are
+	// counted by differ.CountKeys.
+	Stats bool
+	// Schema outputs only added and removed key paths and type changes instead of Format.
+	Schema bool
+	// AddMarker and RemoveMarker prefix new and old values in formatText. They default to + and -.
+	AddMarker    string
+	RemoveMarker string
+	// PathStyle is pathStyleCmp (the default), pathStylePlistBuddy or pathStyleJSONPath
+	PathStyle string
+	// RelativeTo is a directory prefix to strip from filenames.
+	RelativeTo string
+	// Log gets warnings about filenames that aren't under RelativeTo.
+	Log *logger
+}
+
+// write writes the formatted diff to w.
+func (f *formatter) write(w io.Writer, diff fsDiff) error {
+	out := f.format(diff)
+	if f.Format != formatJSONL && f.Format != formatPlistBuddy && f.Format != formatCompact && f.Format != formatMobileConfig && f.Format != formatOverlay && !f.Schema && !f.NameOnly && !f.Stats {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// fileText renders the diffs for one file in formatText
+func (f *formatter) fileText(diffs plistDiff) string {
+	result := ""
+	for i := range diffs {
+		result += f.diffText(&diffs[i]) + "\n"
+	}
+	return strings.TrimRight(result, "\n")
+}
+
+func (f *formatter) diffText(d *FileDiff) string {
+	if d.equal {
+		return fmt.Sprintf("\t=%s: %s%s%s\n", f.diffPath(d), f.value(d.new), typeSuffix(d.new), lineSuffix(d.newLine))
+	}
+	var s string
+	for i := range d.contextBefore {
+		s += f.contextText(&d.contextBefore[i])
+	}
+	if d.old != nil {
+		s += fmt.Sprintf("\t%s%s: %s%s%s\n", f.removeMarker(), f.diffPath(d), f.value(d.old), typeSuffix(d.old), lineSuffix(d.oldLine))
+	}
+	if d.new != nil {
+		s += fmt.Sprintf("\t%s%s: %s%s%s%s\n", f.addMarker(), f.diffPath(d), f.value(d.new), typeSuffix(d.new), lineSuffix(d.newLine), noteSuffix(d.note))
+	}
+	for i := range d.contextAfter {
+		s += f.contextText(&d.contextAfter[i])
+	}
+	return s
+}
+
+func (f *formatter) addMarker() string {
+	if f.AddMarker == "" {
+		return "+"
+	}
+	return f.AddMarker
+}
+
+func (f *formatter) removeMarker() string {
+	if f.RemoveMarker == "" {
+		return "-"
+	}
+	return f.RemoveMarker
+}
+
+func (f *formatter) contextText(d *FileDiff) string {
+	return fmt.Sprintf("\t %s: %s%s\n", f.diffPath(d), f.value(d.new), typeSuffix(d.new))
+}
+
+// value renders a value for output, truncating scalars longer than MaxValueLength.
+func (f *formatter) value(v interface{}) string {
+	s := formatValue(v)
+	if f.MaxValueLength <= 0 || isComposite(v) {
+		return s
+	}
+	n := utf8.RuneCountInString(s)
+	if n <= f.MaxValueLength {
+		return s
+	}
+	return fmt.Sprintf("%s…(truncated, %d total)", string([]rune(s)[:f.MaxValueLength]), n)
+}
+
+// historyValue renders a value for a single-file watch log.
+func (f *formatter) historyValue(v interface{}) string {
+	if v == nil {
+		return string(plistMissing)
+	}
+	return f.value(v)
+}
+
+// noteSuffix is note in brackets, or nothing when there is no note
+func noteSuffix(note string) string {
+	if note == "" {
+		return ""
+	}
+	return " [" + note + "]"
+}
+
+// typeSuffix is the Go type of v in parentheses, or nothing for values that don't come from a plist
+func typeSuffix(v interface{}) string {
+	switch v.(type) {
+	case plistState, byteSize, keyCount, keyOrder, byteContext:
+		return ""
+	default:
+		return fmt.Sprintf(" (%T)", v)
+	}
+}
+
+// isComposite is true for dicts and arrays
+func isComposite(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// section is a group of diffs output under one header
+type section struct {
+	header string
+	diffs  plistDiff
+}
+
+func (f *formatter) format(diff fsDiff) string {
+	if f.RelativeTo != "" {
+		diff = f.rebase(diff)
+	}
+	if f.NameOnly {
+		return f.names(diff)
+	}
+	if f.Stats {
+		return f.stats(diff)
+	}
+	if f.Schema {
+		return f.schema(diff)
+	}
+	if f.Format == formatPlistBuddy {
+		return f.plistBuddyScript(diff)
+	}
+	if f.Format == formatCompact {
+		return f.compact(diff)
+	}
+	if f.Format == formatMobileConfig {
+		return f.mobileConfig(diff)
+	}
+	if f.Format == formatOverlay {
+		return f.overlay(diff)
+	}
+	var s string
+	if f.Format == formatJSONL {
+		now := time.Now()
+		for _, filename := range f.filenames(diff) {
+			s += f.jsonLine(now, filename, diff[filename]) + "\n"
+		}
+		return s
+	}
+	for _, sec := range f.sections(diff) {
+		if f.Format == formatColumns {
+			s += fmt.Sprintf("%s:\n%s\n", sec.header, f.columns(sec.diffs))
+			continue
+		}
+		s += fmt.Sprintf("%s:\n%s\n\n", sec.header, f.fileText(sec.diffs))
+	}
+	return s
+}
+
+// summary renders a one line summary of the files with changes and the number of changes in each.
+func (f *formatter) summary(diff fsDiff, lastChange time.Time) string {
+	var files []string
+	for _, filename := range f.filenames(diff) {
+		if n := diff[filename].changes(); n > 0 {
+			files = append(files, fmt.Sprintf("%s (%d)", filename, n))
+		}
+	}
+	s := fmt.Sprintf("%d files changed", len(files))
+	if len(files) > 0 {
+		s += ": " + strings.Join(files, ", ")
+	}
+	if !lastChange.IsZero() {
+		s += " — last change " + lastChange.Format("15:04:05")
+	}
+	return s
+}
+
+// names renders the names of files with changes, one per line or NUL terminated with Print0
+func (f *formatter) names(diff fsDiff) string {
+	end := "\n"
+	if f.Print0 {
+		end = "\x00"
+	}
+	var s string
+	for _, filename := range f.filenames(diff) {
+		if diff[filename].changes() > 0 {
+			s += filename + end
+		}
+	}
+	return s
+}
+
+// stats renders a line for each file with changes like "x.plist: 2 of 150 keys changed". Only
+// changes to values are counted, not pseudo-diffs like mtime.
+func (f *formatter) stats(diff fsDiff) string {
+	var s string
+	for _, filename := range f.filenames(diff) {
+		changed := map[string]bool{}
+		var total keyCount
+		for i := range diff[filename] {
+			d := &diff[filename][i]
+			if n, ok := d.new.(keyCount); ok && d.keys == nil {
+				total = n
+				continue
+			}
+			if !d.equal && d.keys != nil {
+				changed[statsKey(d)] = true
+			}
+		}
+		if len(changed) > 0 {
+			s += fmt.Sprintf("%s: %d of %d keys changed\n", filename, len(changed), total)
+		}
+	}
+	return s
+}
+
+// statsKey identifies the key d changes. Byte diffs inside a data value all belong to the data's key.
+func statsKey(d *FileDiff) string {
+	keys := d.keys
+	_, oldByte := d.old.(uint8)
+	_, newByte := d.new.(uint8)
+	if (oldByte || newByte) && len(keys) > 0 {
+		keys = keys[:len(keys)-1]
+	}
+	return fmt.Sprintf("%#v", keys)
+}
+
+// rebase strips RelativeTo from the filenames in diff. Filenames that aren't under RelativeTo are kept
+// as is, with a warning the first time they are seen.
+func (f *formatter) rebase(diff fsDiff) fsDiff {
+	prefix := strings.TrimSuffix(path.Clean(f.RelativeTo), "/") + "/"
+	rebased := make(fsDiff, len(diff))
+	for filename, fileDiff := range diff {
+		if strings.HasPrefix(filename, prefix) {
+			rebased[strings.TrimPrefix(filename, prefix)] = fileDiff
+			continue
+		}
+		rebased[filename] = fileDiff
+		f.Log.warnOncef("not under:"+filename, "%s is not under %s", filename, f.RelativeTo)
+	}
+	return rebased
+}
+
+func (f *formatter) sections(diff fsDiff) []section {
+	filenames := f.filenames(diff)
+	if f.Dedup {
+		return dedupSections(diff, filenames)
+	}
+	sections := make([]section, len(filenames))
+	for i, filename := range filenames {
+		sections[i] = section{
+			header: filename,
+			diffs:  diff[filename],
+		}
+	}
+	return sections
+}
+
+// dedupSections groups diffs that are found in more than one file into sections headed by the list
+// of files they are in. These come first, followed by a section for each file with its remaining
+// diffs.
+func dedupSections(diff fsDiff, filenames []string) []section {
+	diffFiles := map[string][]string{}
+	for _, filename := range filenames {
+		for i := range diff[filename] {
+			id := diffIdentity(&diff[filename][i])
+			diffFiles[id] = append(diffFiles[id], filename)
+		}
+	}
+	var shared []section
+	sharedIdx := map[string]int{}
+	unique := map[string]plistDiff{}
+	for _, filename := range filenames {
+		for _, d := range diff[filename] {
+			files := diffFiles[diffIdentity(&d)]
+			if len(files) < 2 {
+				unique[filename] = append(unique[filename], d)
+				continue
+			}
+			if files[0] != filename {
+				continue
+			}
+			header := fmt.Sprintf("in %d files: %s", len(files), strings.Join(files, ", "))
+			idx, ok := sharedIdx[header]
+			if !ok {
+				idx = len(shared)
+				sharedIdx[header] = idx
+				shared = append(shared, section{header: header})
+			}
+			shared[idx].diffs = append(shared[idx].diffs, d)
+		}
+	}
+	sections := shared
+	for _, filename := range filenames {
+		if len(unique[filename]) > 0 {
+			sections = append(sections, section{
+				header: filename,
+				diffs:  unique[filename],
+			})
+		}
+	}
+	return sections
+}
+
+// diffIdentity is a key that is the same for identical diffs in different files
+func diffIdentity(d *FileDiff) string {
+	id := *d
+	id.oldLine, id.newLine = 0, 0
+	return id.String()
+}
+
+// filenames returns the filenames in diff in the order they should be output.
+func (f *formatter) filenames(diff fsDiff) []string {
+	filenames := make([]string, 0, len(diff))
+	for filename := range diff {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	if f.Sort == sortByChanges {
+		sort.SliceStable(filenames, func(i, j int) bool {
+			return diff[filenames[i]].changes() > diff[filenames[j]].changes()
+		})
+	}
+	return filenames
+}
+
+// columns renders each diff as its path followed by a row with the old value on the left and the
+// new value on the right.
+func (f *formatter) columns(diffs plistDiff) string {
+	width := f.Width
+	if width <= 0 {
+		width = defaultWidth
+	}
+	// 4 spaces of indentation plus " | " between the columns
+	colWidth := (width - 7) / 2
+	var s string
+	for i := range diffs {
+		d := &diffs[i]
+		s += fmt.Sprintf("  %s\n", f.diffPath(d))
+		old := f.columnValue(d.old)
+		if d.equal {
+			old = f.columnValue(d.new)
+		}
+		row := fmt.Sprintf("    %s | %s", padRight(truncate(old, colWidth), colWidth), truncate(f.columnValue(d.new), colWidth))
+		s += strings.TrimRight(row, " ") + "\n"
+	}
+	return s
+}
+
+func (f *formatter) columnValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if !f.Expand {
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Map:
+			return "{…}"
+		case reflect.Slice, reflect.Array:
+			if _, ok := v.([]byte); !ok {
+				return "[…]"
+			}
+		}
+	}
+	return strings.ReplaceAll(f.value(v), "\n", " ")
+}
+
+// truncate shortens s to at most n runes, replacing the end with … when it is too long.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+func padRight(s string, n int) string {
+	count := len([]rune(s))
+	if count >= n {
+		return s
+	}
+	return s + strings.Repeat(" ", n-count)
+}
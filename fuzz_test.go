@@ -0,0 +1,55 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// fuzzDecodeOptions keeps fuzzed plists from nesting deeply enough to be slow
+var fuzzDecodeOptions = decodeOptions{maxDepth: 32}
+
+func FuzzDecode(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		val, _, err := decodePlist(data, fuzzDecodeOptions)
+		decoded, valueErr := decodeValue(data, fuzzDecodeOptions)
+		var nestErr *nestingError
+		switch {
+		case errors.As(err, &nestErr):
+			if valueErr == nil {
+				t.Fatalf("decodeValue didn't return the nesting error %v", err)
+			}
+			return
+		case err != nil:
+			if decoded != plistUnparseable {
+				t.Fatalf("decodeValue returned %v for data decodePlist can't decode: %v", decoded, err)
+			}
+			return
+		case valueErr != nil:
+			t.Fatalf("decodeValue returned an error for data decodePlist decodes: %v", valueErr)
+		}
+		formatValue(val)
+		jsonValue(val, &cycleGuard{})
+	})
+}
+
+func FuzzDiffPlists(f *testing.F) {
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		eq, delta, err := diffPlists(a, b, fuzzDecodeOptions, reportOptions{context: 1})
+		if err != nil {
+			var nestErr *nestingError
+			if !errors.As(err, &nestErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+		if eq && delta.changes() > 0 {
+			t.Fatalf("equal plists have %d changes", delta.changes())
+		}
+		_ = delta.String()
+		(&formatter{Format: formatColumns, Width: 80}).columns(delta)
+		(&formatter{}).jsonDiffs(delta)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fuzzyKey normalizes a dict key so that keys that only differ by case, underscores, hyphens or
+// spaces like MyKey, myKey and my_key are the same.
+func fuzzyKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '_', '-', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+}
+
+// matchRenamedKeys replaces a dict key that is removed and a key in the same dict with the same
+// fuzzyKey that is added with a single diff at the new key noting the rename. Keys with more than
+// one candidate on either side are left as they are.
+func matchRenamedKeys(delta plistDiff) plistDiff {
+	type candidates struct {
+		removed []int
+		added   []int
+	}
+	groups := map[string]*candidates{}
+	var order []string
+	for i := range delta {
+		d := &delta[i]
+		if d.equal || !isDictKey(d.keys) || d.old != nil && d.new != nil {
+			continue
+		}
+		parent := fmt.Sprintf("%#v", d.keys[:len(d.keys)-1])
+		group := parent + "\x00" + fuzzyKey(d.keys[len(d.keys)-1].(string))
+		if groups[group] == nil {
+			groups[group] = &candidates{}
+			order = append(order, group)
+		}
+		if d.new == nil {
+			groups[group].removed = append(groups[group].removed, i)
+		} else {
+			groups[group].added = append(groups[group].added, i)
+		}
+	}
+	drop := map[int]bool{}
+	for _, group := range order {
+		c := groups[group]
+		if len(c.removed) != 1 || len(c.added) != 1 {
+			continue
+		}
+		removed, added := &delta[c.removed[0]], &delta[c.added[0]]
+		added.old = removed.old
+		added.note = "renamed from " + removed.keys[len(removed.keys)-1].(string)
+		// cmp.Equal rather than reflect.DeepEqual so that dates are compared by instant
+		if cmp.Equal(added.old, added.new) {
+			added.note += ", value unchanged"
+		}
+		drop[c.removed[0]] = true
+	}
+	if len(drop) == 0 {
+		return delta
+	}
+	kept := delta[:0]
+	for i := range delta {
+		if !drop[i] {
+			kept = append(kept, delta[i])
+		}
+	}
+	return kept
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+type gitCmd struct {
+	RevA string `kong:"arg,name='rev',help='git revision to compare from'"`
+	RevB string `kong:"arg,name='otherrev',help='git revision to compare to'"`
+	Path string `kong:"arg,optional,help='directory or file in the repository to compare. defaults to the current directory'"`
+	compareOptions
+}
+
+// Run compares Path at two revisions of the git repository in the current directory.
+func (c *gitCmd) Run(kctx *kong.Context) error {
+	d, err := c.differ(kctx.Stderr)
+	if err != nil {
+		return err
+	}
+	spec, err := gitPathspec(c.Path)
+	if err != nil {
+		return err
+	}
+	a, err := gitTree(c.RevA, spec)
+	if err != nil {
+		return err
+	}
+	b, err := gitTree(c.RevB, spec)
+	if err != nil {
+		return err
+	}
+	_, diff, err := d.diffFS(a, b)
+	if err != nil {
+		return err
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return c.formatter().write(newOutputWriter(kctx.Stdout, c.OutputEncoding), diff)
+}
+
+// gitPathspec returns p relative to the top of the git repository in the current directory.
+func gitPathspec(p string) (string, error) {
+	prefix, err := runGit("rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		p = "."
+	}
+	spec := path.Clean(path.Join(strings.TrimSpace(prefix), filepath.ToSlash(p)))
+	if spec == ".." || strings.HasPrefix(spec, "../") {
+		return "", fmt.Errorf("%s is outside the git repository", p)
+	}
+	return spec, nil
+}
+
+// gitTree returns the files under spec at rev. Files are named relative to spec, except when spec is
+// a file, which is named by singleFileKey. When spec doesn't exist at rev, the tree is empty.
+func gitTree(rev, spec string) (*memFS, error) {
+	top, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-C", strings.TrimSpace(top), "archive", "--format=tar", rev}
+	if spec != "." {
+		args = append(args, "--", spec)
+	}
+	tree := newMemFS()
+	out, err := runGit(args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "did not match any files") {
+			return tree, nil
+		}
+		return nil, err
+	}
+	tr := tar.NewReader(strings.NewReader(out))
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			return tree, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := hdr.Name
+		switch {
+		case spec == ".":
+		case name == spec:
+			name = singleFileKey(name)
+		default:
+			name = strings.TrimPrefix(name, spec+"/")
+		}
+		var data []byte
+		data, err = io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		err = writeSnapshotEntry(tree, name, snapshotEntry{
+			Data:    data,
+			ModTime: hdr.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// runGit runs git with args and returns its stdout. Errors include git's stderr.
+func runGit(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %v", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
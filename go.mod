@@ -3,16 +3,17 @@ module github.com/willabides/plist-diff
 go 1.17
 
 require (
-	github.com/alecthomas/kong v0.2.17
+	github.com/alecthomas/kong v0.2.18
 	github.com/google/go-cmp v0.5.6
 	github.com/gosuri/uilive v0.0.4
 	github.com/psanford/memfs v0.0.0-20210214183328-a001468d78ef
+	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
 	howett.net/plist v0.0.0-20201203080718-1454fab16a06
 )
 
 require (
 	github.com/mattn/go-isatty v0.0.13 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	golang.org/x/sys v0.0.0-20200116001909-b77594299b42 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
 	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
 )
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/google/go-cmp/cmp"
+)
+
+type grepKeyCmd struct {
+	Key               string        `kong:"arg,help='key path to look up like root.Foo.Bar. array items are numbers like root.Foo.0'"`
+	A                 string        `kong:"arg,name='tree',help='directory tree, file, archive, quoted glob or URL to search'"`
+	B                 string        `kong:"arg,optional,name='othertree',help='tree to compare to. only files where the value differs are output'"`
+	PermissionsErrors bool          `kong:"help='return an error when a file cannot be opened due to insufficient permissions. these errors are ignored by default'"`
+	Timeout           time.Duration `kong:"default=30s,placeholder=DURATION,help='how long to wait when downloading a tree given as an http or https URL'"`
+}
+
+// Run writes the value at Key in each plist in A that has it, or the files where it differs between
+// A and B.
+func (c *grepKeyCmd) Run(kctx *kong.Context) error {
+	keys := parseKeyPath(c.Key)
+	d := &differ{
+		IgnorePermissionError: !c.PermissionsErrors,
+		FetchTimeout:          c.Timeout,
+		MaxNesting:            defaultMaxNesting,
+		Log:                   newLogger(kctx.Stderr, "warn"),
+	}
+	trees := []string{c.A}
+	if c.B != "" {
+		trees = append(trees, c.B)
+	}
+	fss, err := d.getFSs(trees...)
+	if err != nil {
+		return err
+	}
+	values := make([]map[string]interface{}, len(fss))
+	for i := range fss {
+		values[i], err = d.keyValues(fss[i], keys)
+		if err != nil {
+			return err
+		}
+	}
+	if c.B == "" {
+		return writeKeyValues(kctx.Stdout, values[0])
+	}
+	return writeKeyChanges(kctx.Stdout, values[0], values[1])
+}
+
+// parseKeyPath splits a key path like root.Foo.0 into dict keys and array indexes. The leading root
+// is optional. Segments that are numbers are used as dict keys where the value is a dict.
+func parseKeyPath(s string) []string {
+	if s == "root" {
+		return nil
+	}
+	s = strings.TrimPrefix(s, "root.")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
+
+// lookupKeyPath returns the value at keys in v.
+func lookupKeyPath(v interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			v, ok = val[key]
+			if !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, false
+			}
+			v = val[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// keyValues returns the value at keys in each plist in fsys that has it. Files that can't be
+// decoded are skipped.
+func (d *differ) keyValues(fsys fs.FS, keys []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	err := d.WalkPlists(fsys, func(filename string, val interface{}) error {
+		if found, ok := lookupKeyPath(val, keys); ok {
+			values[filename] = found
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func writeKeyValues(w io.Writer, values map[string]interface{}) error {
+	for _, filename := range sortedKeys(values) {
+		_, err := fmt.Fprintf(w, "%s: %s%s\n", filename, formatValue(values[filename]), typeSuffix(values[filename]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeKeyChanges writes the files where the value differs between a and b.
+func writeKeyChanges(w io.Writer, a, b map[string]interface{}) error {
+	filenames := sortedKeys(a)
+	for filename := range b {
+		if _, ok := a[filename]; !ok {
+			filenames = append(filenames, filename)
+		}
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		old, oldOK := a[filename]
+		val, newOK := b[filename]
+		// cmp.Equal rather than reflect.DeepEqual so that dates are compared by instant
+		if oldOK == newOK && cmp.Equal(old, val) {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s: %s → %s\n", filename, keyValueText(old, oldOK), keyValueText(val, newOK))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func keyValueText(v interface{}, ok bool) string {
+	if !ok {
+		return string(plistMissing)
+	}
+	return formatValue(v) + typeSuffix(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseKeyPath(t *testing.T) {
+	for _, td := range []struct {
+		path string
+		want []string
+	}{
+		{path: "root", want: nil},
+		{path: "", want: nil},
+		{path: "root.Foo.0", want: []string{"Foo", "0"}},
+		{path: "Foo.0", want: []string{"Foo", "0"}},
+		{path: "rootless.Foo", want: []string{"rootless", "Foo"}},
+		{path: "root.rootless", want: []string{"rootless"}},
+		{path: "roots", want: []string{"roots"}},
+	} {
+		td := td
+		t.Run(td.path, func(t *testing.T) {
+			if diff := cmp.Diff(td.want, parseKeyPath(td.path)); diff != "" {
+				t.Errorf("keys (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// ignoreRule ignores changes at key paths matching any of paths in files matching files.
+type ignoreRule struct {
+	// files is a path.Match pattern for relative filenames or base names
+	files string
+	// paths are path.Match patterns for key paths like the ones for --numeric-threshold-path. Changes
+	// under a matching key path are ignored too.
+	paths []string
+}
+
+// readIgnoreRules reads ignore rules from a plist file. The plist is a dict with filename globs for
+// keys and arrays of key path globs for values.
+func readIgnoreRules(filename string) ([]ignoreRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	dict, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a dict of filename globs to arrays of key path globs", filename)
+	}
+	var rules []ignoreRule
+	for files, v := range dict {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must be an array of key path globs", filename, files)
+		}
+		rule := ignoreRule{
+			files: files,
+		}
+		for _, p := range list {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be an array of key path globs", filename, files)
+			}
+			rule.paths = append(rule.paths, s)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matchesFile is true when filename or its base name matches the rule's files pattern.
+func (r *ignoreRule) matchesFile(filename string) bool {
+	if ok, _ := path.Match(r.files, filename); ok {
+		return true
+	}
+	ok, _ := path.Match(r.files, path.Base(filename))
+	return ok
+}
+
+// applyIgnoreRules removes the diffs in filename that rules ignore.
+func applyIgnoreRules(rules []ignoreRule, filename string, delta plistDiff) plistDiff {
+	var patterns []string
+	for i := range rules {
+		if rules[i].matchesFile(filename) {
+			patterns = append(patterns, rules[i].paths...)
+		}
+	}
+	if len(patterns) == 0 {
+		return delta
+	}
+	var kept plistDiff
+	for _, d := range delta {
+		if d.keys != nil && matchKeyPathOrParent(patterns, d.keys) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// matchKeyPathOrParent is true when keys or the keys of one of its parents match any of patterns
+func matchKeyPathOrParent(patterns []string, keys []interface{}) bool {
+	for i := len(keys); i >= 0; i-- {
+		if matchKeyPath(patterns, keys[:i]) {
+			return true
+		}
+	}
+	return false
+}
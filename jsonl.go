@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"howett.net/plist"
+)
+
+type jsonDiff struct {
+	Path  string      `json:"path"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+	Equal bool        `json:"equal,omitempty"`
+	Note  string      `json:"note,omitempty"`
+}
+
+type jsonFileDiff struct {
+	Time  time.Time  `json:"time"`
+	File  string     `json:"file"`
+	Diffs []jsonDiff `json:"diffs"`
+}
+
+// jsonLine renders the diffs for one file as a single line of JSON.
+func (f *formatter) jsonLine(t time.Time, filename string, diffs plistDiff) string {
+	line := jsonFileDiff{
+		Time:  t,
+		File:  filename,
+		Diffs: f.jsonDiffs(diffs),
+	}
+	b, err := json.Marshal(&line)
+	if err != nil {
+		// jsonValue only produces values that encoding/json can marshal
+		panic(err)
+	}
+	return string(b)
+}
+
+func (f *formatter) jsonDiffs(diffs plistDiff) []jsonDiff {
+	result := make([]jsonDiff, len(diffs))
+	for i := range diffs {
+		result[i] = jsonDiff{
+			Path:  f.diffPath(&diffs[i]),
+			Old:   jsonValue(diffs[i].old, &cycleGuard{}),
+			New:   jsonValue(diffs[i].new, &cycleGuard{}),
+			Equal: diffs[i].equal,
+			Note:  diffs[i].note,
+		}
+	}
+	return result
+}
+
+// jsonValue converts a decoded plist value to a value that encoding/json can marshal. Cycles are
+// replaced with a marker string because JSON can't represent them.
+func jsonValue(v interface{}, guard *cycleGuard) interface{} {
+	marker, ok := guard.enter(v)
+	if !ok {
+		return marker
+	}
+	defer guard.leave(v)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			guard.push(key)
+			m[key] = jsonValue(val, guard)
+			guard.pop()
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			guard.push(i)
+			s[i] = jsonValue(val, guard)
+			guard.pop()
+		}
+		return s
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return v
+	case plist.UID:
+		return uint64(v)
+	case time.Time:
+		// encoding/json can't marshal years outside of 0-9999, which binary plists can hold
+		if v.Year() < 0 || v.Year() > 9999 {
+			return v.Format(time.RFC3339Nano)
+		}
+		return v
+	default:
+		return v
+	}
+}
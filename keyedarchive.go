@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+	"howett.net/plist"
+)
+
+// normalizeObjectsTransform is the name of the transformer from normalizeObjects
+const normalizeObjectsTransform = "normalizeObjects"
+
+// normalizeObjects compares NSKeyedArchiver archives with their $objects in a canonical order so
+// that archives of the same object graph are equal no matter what order the archiver wrote the
+// objects in. The graph itself isn't decoded.
+func normalizeObjects() cmp.Option {
+	return cmp.FilterValues(func(x, y map[string]interface{}) bool {
+		return isKeyedArchive(x) && isKeyedArchive(y)
+	}, cmp.Transformer(normalizeObjectsTransform, canonicalArchive))
+}
+
+// isKeyedArchive is true for dicts with the $archiver, $top and $objects keys of a keyed archive
+func isKeyedArchive(m map[string]interface{}) bool {
+	if _, ok := m["$archiver"]; !ok {
+		return false
+	}
+	_, ok := m["$top"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = m["$objects"].([]interface{})
+	return ok
+}
+
+// canonicalArchive returns a copy of archive with $objects reordered and UIDs renumbered to match.
+// Objects are numbered breadth first from $null and the $top entries in key order. Objects that
+// can't be reached from $top follow, ordered by their content.
+func canonicalArchive(archive map[string]interface{}) map[string]interface{} {
+	objects := archive["$objects"].([]interface{})
+	top := archive["$top"].(map[string]interface{})
+	renumbered := make(map[uint64]uint64, len(objects))
+	var order []uint64
+	visit := func(uid uint64) {
+		if _, ok := renumbered[uid]; ok || uid >= uint64(len(objects)) {
+			return
+		}
+		renumbered[uid] = uint64(len(order))
+		order = append(order, uid)
+	}
+	if len(objects) > 0 {
+		// $null is always first
+		visit(0)
+	}
+	for _, uid := range archiveUIDs(top) {
+		visit(uid)
+	}
+	// order grows as objects are visited, so this is a breadth first walk without recursion
+	for i := 0; i < len(order); i++ {
+		for _, uid := range archiveUIDs(objects[order[i]]) {
+			visit(uid)
+		}
+	}
+	var unreachable []uint64
+	for uid := range objects {
+		if _, ok := renumbered[uint64(uid)]; !ok {
+			unreachable = append(unreachable, uint64(uid))
+		}
+	}
+	sort.Slice(unreachable, func(i, j int) bool {
+		return formatValue(objects[unreachable[i]]) < formatValue(objects[unreachable[j]])
+	})
+	for _, uid := range unreachable {
+		visit(uid)
+	}
+
+	result := make(map[string]interface{}, len(archive))
+	for key, val := range archive {
+		result[key] = val
+	}
+	canonical := make([]interface{}, len(objects))
+	for i, uid := range order {
+		canonical[i] = renumberUIDs(objects[uid], renumbered)
+	}
+	result["$objects"] = canonical
+	result["$top"] = renumberUIDs(top, renumbered)
+	return result
+}
+
+// archiveUIDs returns the UIDs referenced by v in a deterministic order: dict entries by key and
+// array items by index.
+func archiveUIDs(v interface{}) []uint64 {
+	switch v := v.(type) {
+	case plist.UID:
+		return []uint64{uint64(v)}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var uids []uint64
+		for _, key := range keys {
+			uids = append(uids, archiveUIDs(v[key])...)
+		}
+		return uids
+	case []interface{}:
+		var uids []uint64
+		for _, val := range v {
+			uids = append(uids, archiveUIDs(val)...)
+		}
+		return uids
+	default:
+		return nil
+	}
+}
+
+// renumberUIDs returns a copy of v with its UIDs replaced according to renumbered. UIDs that aren't
+// in renumbered are kept as is.
+func renumberUIDs(v interface{}, renumbered map[uint64]uint64) interface{} {
+	switch v := v.(type) {
+	case plist.UID:
+		if n, ok := renumbered[uint64(v)]; ok {
+			return plist.UID(n)
+		}
+		return v
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = renumberUIDs(val, renumbered)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = renumberUIDs(val, renumbered)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// lineUnavailable is the line number for diffs in files that source locations can't be found for
+const lineUnavailable = -1
+
+// xmlLines maps the paths in an XML plist to the line numbers where they are found. Dict entries
+// map to the line of their key. It returns nil for data that isn't an XML plist.
+func xmlLines(data []byte) map[string]int {
+	if bytes.HasPrefix(data, []byte("bplist")) {
+		return nil
+	}
+	scanner := &xmlLineScanner{
+		data:    data,
+		decoder: xml.NewDecoder(bytes.NewReader(data)),
+		lines:   map[string]int{},
+		line:    1,
+	}
+	err := scanner.scan()
+	if err != nil || len(scanner.lines) == 0 {
+		return nil
+	}
+	return scanner.lines
+}
+
+type xmlFrame struct {
+	path    string
+	isDict  bool
+	key     string
+	keyLine int
+	index   int
+}
+
+type xmlLineScanner struct {
+	data    []byte
+	decoder *xml.Decoder
+	stack   []*xmlFrame
+	lines   map[string]int
+	// keys is the order of the keys in each dict by path. It is only recorded when it isn't nil.
+	keys   map[string][]string
+	line   int
+	offset int64
+}
+
+// currentLine returns the line number the decoder has read up to
+func (s *xmlLineScanner) currentLine() int {
+	next := s.decoder.InputOffset()
+	s.line += bytes.Count(s.data[s.offset:next], []byte("\n"))
+	s.offset = next
+	return s.line
+}
+
+func (s *xmlLineScanner) scan() error {
+	for {
+		tok, err := s.decoder.Token()
+		if err != nil {
+			if s.decoder.InputOffset() >= int64(len(s.data)) {
+				return nil
+			}
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			err = s.startElement(tok)
+		case xml.EndElement:
+			if (tok.Name.Local == "dict" || tok.Name.Local == "array") && len(s.stack) > 0 {
+				s.stack = s.stack[:len(s.stack)-1]
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *xmlLineScanner) startElement(el xml.StartElement) error {
+	line := s.currentLine()
+	switch el.Name.Local {
+	case "plist":
+		return nil
+	case "key":
+		var key string
+		err := s.decoder.DecodeElement(&key, &el)
+		if err != nil {
+			return err
+		}
+		if len(s.stack) > 0 {
+			top := s.stack[len(s.stack)-1]
+			top.key = key
+			top.keyLine = line
+			if s.keys != nil {
+				s.keys[top.path] = append(s.keys[top.path], key)
+			}
+		}
+		return nil
+	}
+	path := "root"
+	if len(s.stack) > 0 {
+		top := s.stack[len(s.stack)-1]
+		if top.isDict {
+			path = fmt.Sprintf("%s[%q]", top.path, top.key)
+			line = top.keyLine
+		} else {
+			path = fmt.Sprintf("%s[%d]", top.path, top.index)
+			top.index++
+		}
+	}
+	s.lines[path] = line
+	switch el.Name.Local {
+	case "dict", "array":
+		s.stack = append(s.stack, &xmlFrame{
+			path:   path,
+			isDict: el.Name.Local == "dict",
+		})
+		if el.Name.Local == "dict" && s.keys != nil {
+			s.keys[path] = []string{}
+		}
+		return nil
+	default:
+		return s.decoder.Skip()
+	}
+}
+
+// addLines sets the source line numbers on diffs from the XML plists oldData and newData.
+func addLines(diffs plistDiff, oldData, newData []byte) {
+	oldLines := xmlLines(oldData)
+	newLines := xmlLines(newData)
+	for i := range diffs {
+		diffs[i].oldLine = lookupLine(oldLines, diffs[i].path)
+		diffs[i].newLine = lookupLine(newLines, diffs[i].path)
+	}
+}
+
+func lookupLine(lines map[string]int, path string) int {
+	line, ok := lines[path]
+	if !ok {
+		return lineUnavailable
+	}
+	return line
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// logLevels maps --log-level values to levels
+var logLevels = map[string]logLevel{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// logPrefixes are written before messages of each level
+var logPrefixes = map[logLevel]string{
+	levelDebug: "debug: ",
+	levelInfo:  "info: ",
+	levelWarn:  "warning: ",
+	levelError: "error: ",
+}
+
+// logger writes diagnostic messages at or above level to w, keeping them out of the diff output.
+// A nil *logger discards everything.
+type logger struct {
+	w     io.Writer
+	level logLevel
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newLogger(w io.Writer, level string) *logger {
+	return &logger{
+		w:     w,
+		level: logLevels[level],
+		seen:  map[string]bool{},
+	}
+}
+
+func (l *logger) logf(level logLevel, format string, args ...interface{}) {
+	if l == nil || level < l.level {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, logPrefixes[level]+format+"\n", args...)
+}
+
+func (l *logger) debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, format, args...)
+}
+
+func (l *logger) infof(format string, args ...interface{}) {
+	l.logf(levelInfo, format, args...)
+}
+
+func (l *logger) warnf(format string, args ...interface{}) {
+	l.logf(levelWarn, format, args...)
+}
+
+func (l *logger) errorf(format string, args ...interface{}) {
+	l.logf(levelError, format, args...)
+}
+
+// warnOncef is warnf for messages that would otherwise repeat on every watch tick. Only the first
+// message with a given key is written.
+func (l *logger) warnOncef(key, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	seen := l.seen[key]
+	l.seen[key] = true
+	l.mu.Unlock()
+	if !seen {
+		l.warnf(format, args...)
+	}
+}
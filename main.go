@@ -1,17 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
+	"golang.org/x/term"
+	"howett.net/plist"
 )
 
 var version = "dev"
 
 const description = `plist-diff watches a directory tree and reports changes to stdout every 2 seconds.
+The whole tree is checked each time, so new subdirectories are watched too.
 
 It will also compare two directory trees with each other if you give it a second directory tree.
 
+A file given by itself is named by its base name, the same as when it is found in a directory, so
+dir/foo.plist can be compared to dir2. When every tree is a single file they all get the name of the
+first one so they are compared to each other.
+
 On a mac, you can watch for changes to preferences with:
 
 plist-diff ~/Library/Preferences
@@ -19,11 +37,108 @@ plist-diff ~/Library/Preferences
 `
 
 type cliRoot struct {
-	A                 string           `kong:"arg,name='watchtree',help='directory tree (or file) to watch for changes'"`
-	B                 string           `kong:"arg,optional,name='othertree',help='directory tree (or file) to compare instead of watching the first tree for changes'"`
-	Timestamps        bool             `kong:"help='include timestamp data in diffs. timestamps are ignored by default'"`
-	PermissionsErrors bool             `kong:"help='return an error when a file cannot be opened due to insufficient permissions. these errors are ignored by default'"`
-	Version           kong.VersionFlag `kong:"help=${VersionHelp}"`
+	Diff         diffCmd          `kong:"cmd,default=withargs,help='watch a tree for changes or compare two trees. this is the default command'"`
+	WatchTargets watchTargetsCmd  `kong:"cmd,help='watch several trees at once, each with its own options, as listed in a plist config. each line of output starts with the target prefix'"`
+	Baseline     baselineCmd      `kong:"cmd,help='save named baselines and compare trees to them'"`
+	Git          gitCmd           `kong:"cmd,help='compare a directory or file at two revisions of the git repository in the current directory'"`
+	Batch        batchCmd         `kong:"cmd,help='compare the pairs of trees listed in a manifest and output a combined report'"`
+	GrepKey      grepKeyCmd       `kong:"cmd,help='output the value at a key path in each plist that has it, or where it differs between two trees'"`
+	Fanout       fanoutCmd        `kong:"cmd,help='compare a plist at the same relative path under several roots like each user home directory and output the values that differ and who has them'"`
+	Dump         dumpCmd          `kong:"cmd,help='print the values decoded from a plist file'"`
+	Canonicalize canonicalizeCmd  `kong:"cmd,help='write a plist file with sorted keys and consistent formatting so that plists with the same values have the same bytes'"`
+	Apply        applyCmd         `kong:"cmd,help='write a copy of a tree with the plists that differ from another tree replaced'"`
+	Version      kong.VersionFlag `kong:"help=${VersionHelp}"`
+	Profile      string           `kong:"placeholder=FILE,help='write a CPU profile of the run to FILE for go tool pprof'"`
+	Config       kong.ConfigFlag  `kong:"type=existingfile,placeholder=FILE,help='read flags from a plist file. it is a dict with flag names as keys. flags on the command line take precedence'"`
+}
+
+type diffCmd struct {
+	A             string        `kong:"arg,name='watchtree',help='directory tree, file, archive, quoted glob or URL to watch for changes'"`
+	B             string        `kong:"arg,optional,name='othertree',help='directory tree, file, archive, quoted glob or URL to compare instead of watching the first tree for changes'"`
+	Base          string        `kong:"placeholder=TREE,help='common ancestor of watchtree and othertree. reports whether each change is from watchtree (a-only), othertree (b-only), both or is a conflict'"`
+	Check         bool          `kong:"help='output nothing. exit 0 when the trees are the same, 1 when they differ and 2 on error'"`
+	FailOn        string        `kong:"enum='any,added,removed,changed',default=any,help='with --check, only exit 1 when there are changes of this kind. one of any, added, removed or changed'"`
+	Explain       bool          `kong:"help='instead of the changes, output which files are compared and which changes are reported or left out, along with the option responsible'"`
+	CheckEncoding bool          `kong:"help='warn on stderr about XML plists whose bytes do not match their declared encoding'"`
+	WatchOnce     bool          `kong:"help='snapshot the watchtree, wait for enter to be pressed, then output the changes and exit'"`
+	Output        string        `kong:"enum='stdout,stderr',default=stdout,help='where to write the changes. prompts and --digest hashes are written to the other one'"`
+	NoLive        bool          `kong:"help='append changes to the output in watch mode instead of redrawing them in place. this is the default when stdout is not a terminal'"`
+	Settle        time.Duration `kong:"placeholder=DURATION,help='when watch sees a change, wait this long and read the tree again before reporting'"`
+	WatchChecksum bool          `kong:"help='have watch hash every file on each tick to catch writes that keep the modification time and size'"`
+	Digest        bool          `kong:"help='write a hash of the changes to stderr. in watch mode it is written each time the changes change'"`
+	StatsJSON     bool          `kong:"name=stats-json,help='write a line of JSON to stderr, or stdout with --output=stderr, with the number of files compared and changed, the numbers of added, removed and changed values, the bytes read and the elapsed seconds. requires othertree'"`
+	RelativeTime  bool          `kong:"help='when watch appends changes, label them with the time since watch started like +00:02.5 instead of the time of day'"`
+	WatchSummary  bool          `kong:"help='in watch mode, output a one line summary of the changed files and their number of changes instead of the changes'"`
+	UntilChange   bool          `kong:"help='in watch mode, exit after the first changes are output'"`
+	Since         string        `kong:"placeholder=SNAPSHOT,help='watch for changes from a snapshot file or named baseline instead of from the current state of watchtree. - reads the snapshot from stdin'"`
+	OnChange      string        `kong:"placeholder=COMMAND,help='shell command to run when watch sees new changes. changed filenames are passed as arguments and in $PLIST_DIFF_FILES'"`
+	compareOptions
+}
+
+// compareOptions are the flags for commands that compare plists
+type compareOptions struct {
+	Timestamps           bool          `kong:"help='include timestamp data in diffs. timestamps are ignored by default'"`
+	PermissionsErrors    bool          `kong:"help='return an error when a file cannot be opened due to insufficient permissions. these errors are ignored by default'"`
+	AssumeFormat         string        `kong:"enum='auto,xml,binary,openstep',default=auto,help='decode all files as this plist format instead of detecting it. files that cannot be decoded as this format are treated as unparseable'"`
+	RawFallback          bool          `kong:"name=compare-raw-on-decode-failure,help='report files that both fail to decode as different when their bytes differ. otherwise they are treated as equal'"`
+	SourceLocations      bool          `kong:"help='show the line numbers where changes are found in XML plists'"`
+	Context              int           `kong:"placeholder=N,help='show N unchanged entries from the same dict on each side of a change'"`
+	IgnoreEmptyChanges   bool          `kong:"help='ignore changes between empty values. empty strings, arrays and dicts and missing keys are all empty'"`
+	AbsentBoolFalse      bool          `kong:"help='treat a missing dict key as equal to false'"`
+	IgnoreCounters       bool          `kong:"help='ignore changes where an integer increases by no more than --counter-window, like launch counts'"`
+	CounterWindow        uint64        `kong:"default=1,placeholder=N,help='largest increase --ignore-counters ignores'"`
+	FuzzyKeys            bool          `kong:"help='report a dict key that is removed while a key in the same dict that only differs by case, underscores, hyphens or spaces is added, like MyKey and my_key, as a rename. keys with more than one such match are reported as usual'"`
+	ByteDiff             bool          `kong:"help='for files with equal values but different bytes, show the offset of the first differing byte and the bytes around it in hex'"`
+	Canonical            bool          `kong:"help='re-encode plists as XML with sorted keys before comparing them. sizes, line numbers and key order are those of the re-encoded plists'"`
+	OrderedDicts         bool          `kong:"help='also report dicts whose keys are in a different order. only XML plists are checked, with a warning for binary ones'"`
+	ShowEqual            bool          `kong:"help='also output values that are the same on both sides, marked with =. this can be a lot of output'"`
+	FilesFrom            string        `kong:"type=existingfile,placeholder=FILE,help='only compare the relative paths listed in FILE, one per line. blank lines and lines starting with # are ignored'"`
+	RequireFile          []string      `kong:"sep=none,placeholder=NAME,help='error when this relative path is missing from either tree. may be repeated'"`
+	RequireFilesFrom     string        `kong:"type=existingfile,placeholder=FILE,help='error when any relative path listed in FILE is missing from either tree. blank lines and lines starting with # are ignored'"`
+	IgnoreMissing        bool          `kong:"help='do not error when a file from --files-from is in neither tree'"`
+	SkipFile             []string      `kong:"sep=none,placeholder=NAME,help='leave out files with this base name, like com.apple.spotlight.plist. may be repeated'"`
+	IgnoreRules          string        `kong:"type=existingfile,placeholder=FILE,help='plist dict of filename globs to arrays of key path globs. changes at those key paths, and under them, are ignored in matching files'"`
+	Reference            string        `kong:"type=existingfile,placeholder=FILE,help='only compare the key paths found in the plist FILE. its dicts are followed down to their entries and any other value stands for the whole value at that key path'"`
+	Defaults             string        `kong:"type=existingfile,placeholder=FILE,help='plist FILE of default values at their key paths. adding or removing a dict key that holds its default value is not a change'"`
+	WhereKey             string        `kong:"placeholder=KEYPATH,help='only compare plists that have this key path like root.Foo.Bar. array items are numbers like root.Foo.0. a file that gains or loses the key is reported as added or removed'"`
+	IgnoreKey            []string      `kong:"sep=none,placeholder=NAME,help='ignore dict entries with this key wherever they appear. may be repeated'"`
+	Intersection         bool          `kong:"help='only compare files that exist in both trees'"`
+	Streaming            bool          `kong:"help='compare trees by walking them side by side instead of listing all of their files first. this uses less memory for very large trees'"`
+	LogLevel             string        `kong:"enum='debug,info,warn,error',default=warn,help='least severe diagnostic messages to write to stderr. one of debug, info, warn or error'"`
+	Timeout              time.Duration `kong:"default=30s,placeholder=DURATION,help='how long to wait when downloading a tree given as an http or https URL'"`
+	StripComponents      int           `kong:"placeholder=N,help='remove the first N directories from the paths in trees given as .tar, .tar.gz, .tgz or .zip archives'"`
+	ComparePath          []string      `kong:"sep=none,placeholder=PATH=STRATEGY,help='compare values at key paths matching the glob PATH, and everything under them, with STRATEGY. strategies are exact, rounded:N (numbers rounded to N decimal places), unordered (arrays in any order), ignore and semver (changes between versions like 2.10.0 are noted as upgrades or downgrades. strings that only differ by surrounding whitespace are equal). the first matching PATH wins. may be repeated'"`
+	SemverPath           []string      `kong:"sep=none,placeholder=GLOB,help='note whether a change to a version string like 2.10.0 at key paths matching GLOB is an upgrade or a downgrade. strings that are the same version but are written differently, like 2.1 and 2.1.0, are still changes. strings that only differ by surrounding whitespace are equal. the same as --compare-path GLOB=semver after any other --compare-path. may be repeated'"`
+	TransformPath        []string      `kong:"sep=none,placeholder=PATH=TRANSFORM,help='rewrite string values at key paths matching the glob PATH, and everything under them, before comparing them. transforms are lowercase, trim-prefix:STR, trim-suffix:STR and strip:REGEXP (remove every match). the first matching PATH wins. may be repeated'"`
+	DecodeNestedData     bool          `kong:"help='compare data values that are themselves plists by their decoded values instead of their bytes'"`
+	NormalizeObjects     bool          `kong:"help='compare NSKeyedArchiver archives with their $objects in a canonical order so that reordered objects are not changes. reported array indexes are in the canonical order'"`
+	MaxNesting           int           `kong:"default=256,placeholder=N,help='error on plists with dicts and arrays nested more than N levels deep. 0 means no limit'"`
+	SkipLargeData        int           `kong:"placeholder=BYTES,help='ignore changes to data values that are more than BYTES long on either side, like icons and caches'"`
+	NumericThreshold     float64       `kong:"placeholder=X,help='treat numbers as equal when they are no more than X apart'"`
+	NumericThresholdPath []string      `kong:"sep=none,placeholder=GLOB,help='only apply --numeric-threshold to key paths matching GLOB. key paths are dict keys and array indexes joined with / like Nested/Arr/0. may be repeated'"`
+	IgnoreUUIDs          bool          `kong:"name=ignore-uuids,help='treat strings as equal when both look like UUIDs. a UUID and a string that is not one are still different'"`
+	IgnoreUUIDsPath      []string      `kong:"name=ignore-uuids-path,sep=none,placeholder=GLOB,help='only apply --ignore-uuids to key paths matching GLOB like --numeric-threshold-path. may be repeated'"`
+	CoerceSingletons     bool          `kong:"help='treat a single-element array as equal to the value it contains'"`
+	CheckMtime           bool          `kong:"help='report modification time changes for files whose content is the same'"`
+	ShowSize             bool          `kong:"help='show the file sizes for files with changes'"`
+	SizeOnlyChanges      bool          `kong:"help='with --show-size, also report size changes for files whose content is the same'"`
+	Sort                 string        `kong:"enum='name,changes',default=name,help='order files by name or by number of changes (most first)'"`
+	Format               string        `kong:"enum='text,columns,jsonl,plistbuddy,compact,mobileconfig,overlay',default=text,help='output format. columns shows old and new values side by side. jsonl writes a JSON object per file on each line. plistbuddy writes a shell script of PlistBuddy commands that make watchtree match othertree. compact writes a line per change with the filename, path, old value and new value separated by tabs. mobileconfig writes a configuration profile that sets the changed and added keys, with removals noted in comments. overlay writes a plist of the changed values in each file that apply --overlay can apply'"`
+	MaxValueLength       int           `kong:"default=200,placeholder=N,help='truncate values longer than N characters. 0 means no limit'"`
+	Dedup                bool          `kong:"help='output changes that are identical in several files once with the list of files'"`
+	Expand               bool          `kong:"help='show composite values in full with --format=columns'"`
+	RelativeTo           string        `kong:"placeholder=PREFIX,help='strip this directory prefix from the filenames in the output'"`
+	AddMarker            string        `kong:"default=+,placeholder=MARKER,help='prefix for new values in text output'"`
+	RemoveMarker         string        `kong:"default=-,placeholder=MARKER,help='prefix for old values in text output'"`
+	PathStyle            string        `kong:"enum='cmp,plistbuddy,jsonpath',default=cmp,help='how to write key paths. cmp looks like root[\"Foo\"][0], plistbuddy like :Foo:0 and jsonpath like $.Foo[0]'"`
+	Stats                bool          `kong:"help='only output the number of changed keys and the total number of keys in each file with changes'"`
+	NameOnly             bool          `kong:"help='only output the names of files with changes, one per line'"`
+	OutputEncoding       string        `kong:"enum='utf-8,escape,ascii',default=utf-8,help='how to write characters outside of ASCII. escape writes them like \\u00e9 and ascii replaces them with ?. one of utf-8, escape or ascii'"`
+	Print0               bool          `kong:"name=print0,short=z,help='with --name-only, end each name with a NUL byte instead of a newline for xargs -0'"`
+	SchemaDiff           bool          `kong:"help='only output key paths that were added or removed and values whose type changed, without values'"`
+
+	log      *logger
+	onChange *changeCommand
 }
 
 var kongVars = kong.Vars{
@@ -31,30 +146,581 @@ var kongVars = kong.Vars{
 	"VersionHelp": `output the plist-diff version and exit`,
 }
 
+var plistFormats = map[string]int{
+	"auto":     plist.AutomaticFormat,
+	"xml":      plist.XMLFormat,
+	"binary":   plist.BinaryFormat,
+	"openstep": plist.OpenStepFormat,
+}
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// exitCode is panicked by the kong.Exit hook in run to stop parsing or running and return the code
+type exitCode int
+
+// run runs the command in args and returns the exit code. With --check, every error including a
+// usage error exits 2 so that 1 always means the trees differ.
+func run(args []string, stdout, stderr io.Writer) (code int) {
 	var cli cliRoot
-	kctx := kong.Parse(&cli,
+	check := hasCheckFlag(args)
+	defer func() {
+		if r := recover(); r != nil {
+			c, ok := r.(exitCode)
+			if !ok {
+				panic(r)
+			}
+			code = int(c)
+		}
+	}()
+	parser, err := kong.New(&cli,
 		kongVars,
 		kong.Description(description),
+		kong.Configuration(plistConfig),
+		kong.Writers(stdout, stderr),
+		kong.Exit(func(code int) {
+			if check && code != 0 {
+				code = 2
+			}
+			panic(exitCode(code))
+		}),
 	)
-	kctx.FatalIfErrorf(run(kctx, cli))
+	if err != nil {
+		panic(err)
+	}
+	kctx, err := parser.Parse(args)
+	parser.FatalIfErrorf(err)
+	check = check || cli.Diff.Check
+	ctx, stopSignals := signal.NotifyContext(baseContext(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	kctx.BindTo(ctx, (*context.Context)(nil))
+	stopProfile := func() {}
+	if cli.Profile != "" {
+		stopProfile, err = startProfile(cli.Profile)
+		kctx.FatalIfErrorf(err)
+	}
+	err = runCommand(ctx, kctx)
+	stopProfile()
+	if errors.Is(err, errInterrupted) {
+		return 130
+	}
+	if check {
+		return checkExitCode(err)
+	}
+	kctx.FatalIfErrorf(err)
+	return 0
 }
 
-func run(kctx *kong.Context, cli cliRoot) error {
+// baseContext returns the context that run adds interrupt handling to
+var baseContext = context.Background
+
+// errInterrupted is returned by runCommand when the command doesn't return soon after an interrupt
+var errInterrupted = errors.New("interrupted")
+
+// shutdownGrace is how long runCommand waits for the command to return after ctx is done. Watch
+// returns right away. Commands that don't watch ctx are abandoned.
+const shutdownGrace = time.Second
+
+// runCommand runs the selected command. When ctx is done because of an interrupt, it gives the
+// command shutdownGrace to return before returning errInterrupted.
+func runCommand(ctx context.Context, kctx *kong.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- kctx.Run()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(shutdownGrace):
+		return errInterrupted
+	}
+}
+
+// hasCheckFlag is true when args has --check before any --. It is checked before parsing so that
+// usage errors with --check exit 2.
+func hasCheckFlag(args []string) bool {
+	for _, arg := range args {
+		switch {
+		case arg == "--":
+			return false
+		case arg == "--check", strings.HasPrefix(arg, "--check="):
+			return arg != "--check=false"
+		}
+	}
+	return false
+}
+
+// errChanged is returned by diffCmd.Run with --check when the trees differ
+var errChanged = errors.New("trees differ")
+
+// checkExitCode maps the result of --check to an exit code.
+func checkExitCode(err error) int {
+	switch err {
+	case nil:
+		return 0
+	case errChanged:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// differ returns the differ for the options. Diagnostics are written to stderr unless the logger was
+// already set.
+func (o *compareOptions) differ(stderr io.Writer) (*differ, error) {
+	err := o.validate()
+	if err != nil {
+		return nil, err
+	}
 	d := &differ{
-		IgnoreTimestamps:      !cli.Timestamps,
-		IgnorePermissionError: !cli.PermissionsErrors,
+		IgnoreTimestamps:      !o.Timestamps,
+		IgnorePermissionError: !o.PermissionsErrors,
+		Log:                   o.logger(stderr),
+		IgnoreKeys:            o.IgnoreKey,
+		WhereKey:              parseKeyPath(o.WhereKey),
+		ShowEqual:             o.ShowEqual,
+		IgnoreEmptyChanges:    o.IgnoreEmptyChanges,
+		AbsentBoolFalse:       o.AbsentBoolFalse,
+		RawOnDecodeFailure:    o.RawFallback,
+		FuzzyKeys:             o.FuzzyKeys,
+		CounterWindow:         o.counterWindow(),
+		OrderedDicts:          o.OrderedDicts,
+		Canonical:             o.Canonical,
+		ByteDiff:              o.ByteDiff,
+		SourceLocations:       o.SourceLocations,
+		CheckMTime:            o.CheckMtime,
+		Intersection:          o.Intersection,
+		Streaming:             o.Streaming,
+		Context:               o.Context,
+		AssumeFormat:          plistFormats[o.AssumeFormat],
+		IgnoreMissing:         o.IgnoreMissing,
+		CoerceSingletons:      o.CoerceSingletons,
+		DecodeNestedData:      o.DecodeNestedData,
+		NormalizeObjects:      o.NormalizeObjects,
+		MaxNesting:            o.MaxNesting,
+		SkipLargeData:         o.SkipLargeData,
+		NumericThreshold:      o.NumericThreshold,
+		NumericThresholdPaths: o.NumericThresholdPath,
+		IgnoreUUIDs:           o.IgnoreUUIDs,
+		IgnoreUUIDsPaths:      o.IgnoreUUIDsPath,
+		FetchTimeout:          o.Timeout,
+		StripComponents:       o.StripComponents,
+		ShowSize:              o.ShowSize,
+		CountKeys:             o.Stats,
+		SizeOnlyChanges:       o.SizeOnlyChanges,
+	}
+	for _, apply := range differAppliers {
+		err = apply(o, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// validate returns an error for flags that can't be used together
+func (o *compareOptions) validate() error {
+	scriptFormat := o.Format == formatPlistBuddy || o.Format == formatMobileConfig || o.Format == formatOverlay
+	switch {
+	case o.Print0 && !o.NameOnly:
+		return fmt.Errorf("--print0 requires --name-only")
+	case o.OutputEncoding != outputUTF8 && scriptFormat:
+		return fmt.Errorf("--output-encoding=%s cannot be used with --format=%s", o.OutputEncoding, o.Format)
+	case o.FuzzyKeys && scriptFormat:
+		return fmt.Errorf("--fuzzy-keys cannot be used with --format=%s", o.Format)
+	}
+	return nil
+}
+
+// differAppliers set the differ fields for flags that need more than copying a value
+var differAppliers = []func(o *compareOptions, d *differ) error{
+	(*compareOptions).applySkipFile,
+	(*compareOptions).applyComparePath,
+	(*compareOptions).applySemverPath,
+	(*compareOptions).applyTransformPath,
+	(*compareOptions).applyReference,
+	(*compareOptions).applyDefaults,
+	(*compareOptions).applyIgnoreRules,
+	(*compareOptions).applyRequireFile,
+	(*compareOptions).applyRequireFilesFrom,
+	(*compareOptions).applyFilesFrom,
+}
+
+func (o *compareOptions) applySkipFile(d *differ) error {
+	if len(o.SkipFile) == 0 {
+		return nil
+	}
+	d.SkipFiles = make(map[string]bool, len(o.SkipFile))
+	for _, name := range o.SkipFile {
+		d.SkipFiles[name] = true
 	}
-	if cli.B == "" {
-		return d.watch(cli.A, kctx.Stdout)
+	return nil
+}
+
+func (o *compareOptions) applyComparePath(d *differ) error {
+	for _, s := range o.ComparePath {
+		rule, err := parseCompareRule(s)
+		if err != nil {
+			return err
+		}
+		d.CompareRules = append(d.CompareRules, rule)
+	}
+	return nil
+}
+
+func (o *compareOptions) applySemverPath(d *differ) error {
+	for _, pattern := range o.SemverPath {
+		rule, err := parseCompareRule(pattern + "=" + strategySemver)
+		if err != nil {
+			return err
+		}
+		d.CompareRules = append(d.CompareRules, rule)
+	}
+	return nil
+}
+
+func (o *compareOptions) applyTransformPath(d *differ) error {
+	for _, s := range o.TransformPath {
+		rule, err := parseTransformRule(s)
+		if err != nil {
+			return err
+		}
+		d.TransformRules = append(d.TransformRules, rule)
+	}
+	return nil
+}
+
+func (o *compareOptions) applyReference(d *differ) error {
+	if o.Reference == "" {
+		return nil
 	}
-	eq, diff, err := d.diff(cli.A, cli.B)
+	paths, err := readReference(o.Reference)
+	d.ReferencePaths = paths
+	return err
+}
+
+func (o *compareOptions) applyDefaults(d *differ) error {
+	if o.Defaults == "" {
+		return nil
+	}
+	defaults, err := readDefaults(o.Defaults)
+	d.Defaults = defaults
+	return err
+}
+
+func (o *compareOptions) applyIgnoreRules(d *differ) error {
+	if o.IgnoreRules == "" {
+		return nil
+	}
+	rules, err := readIgnoreRules(o.IgnoreRules)
+	d.IgnoreRules = rules
+	return err
+}
+
+func (o *compareOptions) applyRequireFile(d *differ) error {
+	for _, filename := range o.RequireFile {
+		d.RequireFiles = append(d.RequireFiles, path.Clean(filename))
+	}
+	return nil
+}
+
+func (o *compareOptions) applyRequireFilesFrom(d *differ) error {
+	if o.RequireFilesFrom == "" {
+		return nil
+	}
+	files, err := readFileList(o.RequireFilesFrom)
 	if err != nil {
 		return err
 	}
-	if eq {
+	for filename := range files {
+		d.RequireFiles = append(d.RequireFiles, filename)
+	}
+	sort.Strings(d.RequireFiles[len(o.RequireFile):])
+	return nil
+}
+
+func (o *compareOptions) applyFilesFrom(d *differ) error {
+	if o.FilesFrom == "" {
 		return nil
 	}
-	fmt.Fprintln(kctx.Stdout, diff.String())
+	files, err := readFileList(o.FilesFrom)
+	d.Files = files
+	return err
+}
+
+// counterWindow is the differ.CounterWindow for --ignore-counters and --counter-window
+func (o *compareOptions) counterWindow() uint64 {
+	if !o.IgnoreCounters {
+		return 0
+	}
+	return o.CounterWindow
+}
+
+// logger returns the logger for --log-level writing to stderr. It is shared by the differ and
+// formatter so that warnings are only written once.
+func (o *compareOptions) logger(stderr io.Writer) *logger {
+	if o.log == nil {
+		o.log = newLogger(stderr, o.LogLevel)
+	}
+	return o.log
+}
+
+func (o *compareOptions) formatter() *formatter {
+	return &formatter{
+		Sort:     o.Sort,
+		Format:   o.Format,
+		Width:    terminalWidth(os.Stdout),
+		Expand:   o.Expand,
+		Dedup:    o.Dedup,
+		Schema:   o.SchemaDiff,
+		NameOnly: o.NameOnly,
+		Print0:   o.Print0,
+		Stats:    o.Stats,
+		Log:      o.log,
+
+		MaxValueLength: o.MaxValueLength,
+		RelativeTo:     o.RelativeTo,
+		PathStyle:      o.PathStyle,
+		AddMarker:      o.AddMarker,
+		RemoveMarker:   o.RemoveMarker,
+	}
+}
+
+func (c *diffCmd) Run(kctx *kong.Context, ctx context.Context) error {
+	start := time.Now()
+	c.log = newLogger(kctx.Stderr, c.LogLevel)
+	if c.Check {
+		// --check outputs nothing, not even warnings
+		c.log = newLogger(io.Discard, c.LogLevel)
+	}
+	d, err := c.differ(kctx.Stderr)
+	if err != nil {
+		return err
+	}
+	out, other, outFile := kctx.Stdout, kctx.Stderr, os.Stdout
+	if c.Output == "stderr" {
+		out, other, outFile = kctx.Stderr, kctx.Stdout, os.Stderr
+	}
+	out = newOutputWriter(out, c.OutputEncoding)
+	other = newOutputWriter(other, c.OutputEncoding)
+	c.applyWatchOptions(d, kctx.Stderr, other, outFile)
+	if c.StatsJSON && (c.B == "" || c.Base != "" || c.Check || c.Explain) {
+		return fmt.Errorf("--stats-json requires othertree and cannot be used with --base, --check or --explain")
+	}
+	if c.Check {
+		return c.runCheck(d)
+	}
+	f := c.formatter()
+	if c.Explain {
+		return c.runExplain(out, d, f)
+	}
+	f.Width = terminalWidth(outFile)
+	if c.CheckEncoding {
+		err = d.reportEncodings(kctx.Stderr, c.trees()...)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.Base != "":
+		return c.runBase(out, d, f)
+	case c.B == "":
+		return c.runWatch(ctx, out, other, d, f)
+	}
+	return c.runDiff(out, other, d, f, start)
+}
+
+func (c *diffCmd) runExplain(out io.Writer, d *differ, f *formatter) error {
+	if c.B == "" {
+		return fmt.Errorf("--explain requires othertree")
+	}
+	return d.explain(out, f, c.A, c.B)
+}
+
+// runDiff writes the changes between c.A and c.B to out. other gets --digest and --stats-json.
+func (c *diffCmd) runDiff(out, other io.Writer, d *differ, f *formatter, start time.Time) error {
+	if c.Since != "" {
+		return fmt.Errorf("--since cannot be used with othertree or --watch-once")
+	}
+	if c.WatchOnce {
+		return fmt.Errorf("--watch-once cannot be used with othertree")
+	}
+	_, diff, err := d.diff(c.A, c.B)
+	if err != nil {
+		return err
+	}
+	if c.Digest {
+		fmt.Fprintln(other, diff.Digest())
+	}
+	if c.StatsJSON {
+		err = writeStatsJSON(other, d, diff, time.Since(start))
+		if err != nil {
+			return err
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return f.write(out, diff)
+}
+
+// trees is the trees being compared
+func (c *diffCmd) trees() []string {
+	if c.B == "" {
+		return []string{c.A}
+	}
+	return []string{c.A, c.B}
+}
+
+// applyWatchOptions sets the differ fields for the flags that only matter to watch. stderr is for
+// the output of --on-change commands and other is where --digest hashes are written.
+func (c *diffCmd) applyWatchOptions(d *differ, stderr, other io.Writer, outFile *os.File) {
+	d.Settle = c.Settle
+	d.WatchChecksum = c.WatchChecksum
+	d.UntilChange = c.UntilChange
+	d.Summary = c.WatchSummary
+	d.RelativeTime = c.RelativeTime
+	if c.Digest {
+		d.DigestOut = other
+	}
+	d.Live = !c.NoLive && term.IsTerminal(int(outFile.Fd()))
+	if c.OnChange != "" {
+		c.onChange = &changeCommand{
+			command: c.OnChange,
+			stderr:  stderr,
+			log:     d.Log,
+		}
+		d.OnChange = c.onChange.trigger
+	}
+}
+
+// runWatch watches c.A from --since or its current state, or just once with --watch-once.
+func (c *diffCmd) runWatch(ctx context.Context, out, other io.Writer, d *differ, f *formatter) error {
+	if c.Since != "" {
+		if c.WatchOnce {
+			return fmt.Errorf("--since cannot be used with othertree or --watch-once")
+		}
+		var err error
+		d.Since, err = loadSince(c.Since, os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+	if c.WatchOnce {
+		return d.watchOnce(c.A, os.Stdin, out, other, f)
+	}
+	err := d.watch(ctx, c.A, out, f)
+	if c.onChange != nil {
+		// don't exit while the --on-change command is still running
+		c.onChange.wait()
+	}
+	return err
+}
+
+func (c *diffCmd) runCheck(d *differ) error {
+	if c.B == "" {
+		return fmt.Errorf("--check requires othertree")
+	}
+	if c.Base != "" {
+		if c.FailOn != changeAny {
+			return fmt.Errorf("--fail-on cannot be used with --base")
+		}
+		eq, _, err := d.diff3(c.Base, c.A, c.B)
+		if err != nil {
+			return err
+		}
+		if !eq {
+			return errChanged
+		}
+		return nil
+	}
+	_, diff, err := d.diff(c.A, c.B)
+	if err != nil {
+		return err
+	}
+	if diff.hasChange(c.FailOn) {
+		return errChanged
+	}
 	return nil
 }
+
+func (c *diffCmd) runBase(out io.Writer, d *differ, f *formatter) error {
+	if c.B == "" {
+		return fmt.Errorf("--base requires othertree")
+	}
+	if c.WatchOnce {
+		return fmt.Errorf("--base cannot be used with --watch-once")
+	}
+	if f.Format != formatText {
+		return fmt.Errorf("--base only supports --format=text")
+	}
+	eq, diff, err := d.diff3(c.Base, c.A, c.B)
+	if err != nil || eq {
+		return err
+	}
+	_, err = io.WriteString(out, f.merge(diff))
+	return err
+}
+
+// loadSince loads the snapshot file at since. When there is no such file, since is loaded as a
+// baseline name. "-" reads the snapshot from stdin.
+func loadSince(since string, stdin io.Reader) (*memFS, error) {
+	if since == "-" {
+		snap, _, err := readSnapshot(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("stdin: %w", err)
+		}
+		return snap, nil
+	}
+	file, err := os.Open(since)
+	if errors.Is(err, fs.ErrNotExist) && !strings.ContainsAny(since, `/\`) {
+		snap, _, baselineErr := loadBaseline(since)
+		return snap, baselineErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck // only reading
+	snap, _, err := readSnapshot(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", since, err)
+	}
+	return snap, nil
+}
+
+// readFileList reads a list of relative paths from filename. Blank lines and lines starting with #
+// are skipped.
+func readFileList(filename string) (map[string]bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files[path.Clean(line)] = true
+	}
+	return files, nil
+}
+
+// terminalWidth returns the width of the terminal at file or defaultWidth when it isn't a terminal.
+func terminalWidth(file *os.File) int {
+	fd := int(file.Fd())
+	if !term.IsTerminal(fd) {
+		return defaultWidth
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		return defaultWidth
+	}
+	return width
+}
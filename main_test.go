@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExitCodes(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "same", args: []string{"--check", "testdata/exit/a", "testdata/exit/a"}, want: 0},
+		{name: "different", args: []string{"--check", "testdata/exit/a", "testdata/exit/b"}, want: 1},
+		{name: "unparseable", args: []string{"--check", "testdata/exit/a", "testdata/exit/unparseable"}, want: 1},
+		{name: "missing tree", args: []string{"--check", "testdata/exit/a", "testdata/exit/nope"}, want: 2},
+		{name: "unknown flag", args: []string{"diff", "--check", "--bogus", "testdata/exit/a", "testdata/exit/b"}, want: 2},
+		{name: "bad flag value", args: []string{"--check", "--fail-on=sometimes", "testdata/exit/a", "testdata/exit/b"}, want: 2},
+		{name: "missing argument", args: []string{"diff", "--check"}, want: 2},
+		{name: "unknown flag without check", args: []string{"--bogus", "testdata/exit/a"}, want: 1},
+		{name: "fail-on changed", args: []string{"--check", "--fail-on=changed", "testdata/exit/a", "testdata/exit/b"}, want: 1},
+		{name: "fail-on added without additions", args: []string{"--check", "--fail-on=added", "testdata/exit/a", "testdata/exit/b"}, want: 0},
+		{name: "fail-on removed without removals", args: []string{"--check", "--fail-on=removed", "testdata/exit/a", "testdata/exit/b"}, want: 0},
+		{name: "fail-on added file", args: []string{"--check", "--fail-on=added", "testdata/flags/intersection/a", "testdata/flags/intersection/b"}, want: 1},
+		{name: "fail-on removed key", args: []string{"--check", "--fail-on=removed", "testdata/flags/basic/a", "testdata/flags/basic/b"}, want: 1},
+		{name: "fail-on with base", args: []string{"--check", "--fail-on=added", "--base", "testdata/exit/a", "testdata/exit/a", "testdata/exit/b"}, want: 2},
+		{name: "missing required file", args: []string{"--check", "--require-file", "y.plist", "testdata/exit/a", "testdata/exit/a"}, want: 2},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			got := run(td.args, &stdout, &stderr)
+			if got != td.want {
+				t.Errorf("exit code %d, want %d. stderr: %s", got, td.want, stderr.String())
+			}
+			if td.want < 2 && hasCheckFlag(td.args) && stdout.Len()+stderr.Len() > 0 {
+				t.Errorf("unexpected output:\n%s%s", stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cpu.pprof")
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--profile", filename, "testdata/exit/a", "testdata/exit/b"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// profiles are gzipped protocol buffers
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		t.Errorf("%s is not a gzipped profile", filename)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/psanford/memfs"
+)
+
+// memFS is a memfs.FS that keeps the modification times of the files copied into it instead of the
+// time they were copied.
+type memFS struct {
+	*memfs.FS
+	modTimes map[string]time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		FS:       memfs.New(),
+		modTimes: map[string]time.Time{},
+	}
+}
+
+// writeFile writes data to path with the mode and modification time from info.
+func (m *memFS) writeFile(path string, data []byte, info fs.FileInfo) error {
+	err := m.WriteFile(path, data, info.Mode())
+	if err != nil {
+		return err
+	}
+	m.modTimes[path] = info.ModTime()
+	return nil
+}
+
+// copyFile writes the file at filename on disk to name in m, creating its parent directories
+func (m *memFS) copyFile(name, filename string, stat fs.FileInfo) error {
+	if dir := path.Dir(name); dir != "." {
+		err := m.MkdirAll(dir, 0o755)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return m.writeFile(name, data, stat)
+}
+
+// Stat implements fs.StatFS
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fs.Stat(m.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	modTime, ok := m.modTimes[name]
+	if !ok {
+		return info, nil
+	}
+	return &modTimeInfo{
+		FileInfo: info,
+		modTime:  modTime,
+	}, nil
+}
+
+type modTimeInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (i *modTimeInfo) ModTime() time.Time {
+	return i.modTime
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// placeholders for the profile values the user is expected to fill in
+const (
+	mobileConfigIdentifier = "com.example.plist-diff"
+	mobileConfigUUID       = "REPLACE-WITH-UUID"
+)
+
+// mobileConfig renders diff as an XML configuration profile with a payload for each file that
+// sets the keys that were changed or added in it. The payload type is the file's name without
+// .plist, which is the preference domain for files from a Preferences directory.
+//
+// Profiles can't remove keys, so removals are listed in comments before the plist along with
+// changes that a payload can't express, like changes inside arrays. Dicts that only contain their
+// changed entries are listed too since a managed dict replaces the whole value.
+func (f *formatter) mobileConfig(diff fsDiff) string {
+	var notes []string
+	payloads := []interface{}{}
+	for _, filename := range f.filenames(diff) {
+		if diff[filename].changes() == 0 {
+			continue
+		}
+		domain := strings.TrimSuffix(path.Base(filename), ".plist")
+		settings, fileNotes := f.mobileConfigSettings(diff[filename])
+		for _, note := range fileNotes {
+			notes = append(notes, filename+": "+note)
+		}
+		if len(settings) == 0 {
+			continue
+		}
+		settings["PayloadType"] = domain
+		settings["PayloadIdentifier"] = mobileConfigIdentifier + "." + domain
+		settings["PayloadUUID"] = mobileConfigUUID
+		settings["PayloadVersion"] = 1
+		settings["PayloadDisplayName"] = domain
+		payloads = append(payloads, settings)
+	}
+	profile := map[string]interface{}{
+		"PayloadContent":     payloads,
+		"PayloadDisplayName": "plist-diff changes",
+		"PayloadIdentifier":  mobileConfigIdentifier,
+		"PayloadType":        "Configuration",
+		"PayloadUUID":        mobileConfigUUID,
+		"PayloadVersion":     1,
+	}
+	out, err := plist.MarshalIndent(profile, plist.XMLFormat, "\t")
+	if err != nil {
+		return fmt.Sprintf("<!-- can't write configuration profile: %s -->\n", xmlComment(err.Error()))
+	}
+	s := string(out)
+	if len(notes) > 0 {
+		var comments string
+		for _, note := range notes {
+			comments += "<!-- " + xmlComment(note) + " -->\n"
+		}
+		// comments go after the XML declaration and doctype, right before the plist element
+		i := strings.Index(s, "<plist")
+		s = s[:i] + comments + s[i:]
+	}
+	return s + "\n"
+}
+
+// mobileConfigSettings returns the payload settings for the changed and added values in diffs,
+// and notes about the changes that aren't in them.
+func (f *formatter) mobileConfigSettings(diffs plistDiff) (map[string]interface{}, []string) {
+	settings := map[string]interface{}{}
+	var notes []string
+	partial := map[string]bool{}
+	for i := range diffs {
+		d := &diffs[i]
+		if d.equal || d.keys == nil {
+			continue
+		}
+		keyPath := f.diffPath(d)
+		switch {
+		case d.old == plistUnparseable || d.new == plistUnparseable:
+			return nil, []string{"skipped because it could not be parsed as a plist"}
+		case d.new == plistMissing:
+			return nil, []string{"file removed"}
+		case d.new == nil:
+			notes = append(notes, "removed "+keyPath)
+			continue
+		}
+		if len(d.keys) == 0 {
+			root, ok := d.new.(map[string]interface{})
+			if !ok {
+				notes = append(notes, fmt.Sprintf("root is a %T rather than a dict", d.new))
+				continue
+			}
+			for key, val := range root {
+				settings[key] = val
+			}
+			continue
+		}
+		if !setDictPath(settings, d.keys, d.new) {
+			notes = append(notes, "can't express "+keyPath+" because it is in an array")
+			continue
+		}
+		if len(d.keys) > 1 && !partial[d.keys[0].(string)] {
+			partial[d.keys[0].(string)] = true
+			notes = append(notes, fmt.Sprintf("%s only has its changed entries", f.keyPath(fmt.Sprintf("root[%q]", d.keys[0]), d.keys[:1])))
+		}
+	}
+	return settings, notes
+}
+
+// setDictPath sets v at keys in settings, creating the dicts on the way. It is false when keys
+// has an array index since the rest of the array isn't known.
+func setDictPath(settings map[string]interface{}, keys []interface{}, v interface{}) bool {
+	for _, key := range keys {
+		if _, ok := key.(string); !ok {
+			return false
+		}
+	}
+	dict := settings
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := dict[key.(string)].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			dict[key.(string)] = next
+		}
+		dict = next
+	}
+	dict[keys[len(keys)-1].(string)] = v
+	return true
+}
+
+// xmlComment makes s safe to put in an XML comment, which can't contain --.
+func xmlComment(s string) string {
+	return strings.ReplaceAll(s, "--", "- -")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// changeCommand runs a shell command for watch's OnChange hook. Triggers that arrive while the
+// command is running are coalesced into a single run with the latest filenames.
+type changeCommand struct {
+	command string
+	stderr  io.Writer
+	log     *logger
+
+	mu      sync.Mutex
+	running bool
+	pending []string
+	done    sync.WaitGroup
+}
+
+func (c *changeCommand) trigger(filenames []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = filenames
+	if c.running {
+		return
+	}
+	c.running = true
+	c.done.Add(1)
+	go c.loop()
+}
+
+// wait blocks until the command and any coalesced runs have finished.
+func (c *changeCommand) wait() {
+	c.done.Wait()
+}
+
+func (c *changeCommand) loop() {
+	defer c.done.Done()
+	for {
+		c.mu.Lock()
+		filenames := c.pending
+		c.pending = nil
+		if filenames == nil {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		err := c.exec(filenames)
+		if err != nil {
+			c.log.errorf("on-change command failed: %v", err)
+		}
+	}
+}
+
+// exec runs the command with sh. The changed filenames are passed as positional arguments and
+// newline separated in PLIST_DIFF_FILES.
+func (c *changeCommand) exec(filenames []string) error {
+	args := append([]string{"-c", c.command, "sh"}, filenames...)
+	cmd := exec.Command("sh", args...)
+	cmd.Env = append(os.Environ(), "PLIST_DIFF_FILES="+strings.Join(filenames, "\n"))
+	cmd.Stdout = c.stderr
+	cmd.Stderr = c.stderr
+	return cmd.Run()
+}
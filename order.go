@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+	"strings"
+)
+
+// keyOrder is the order of the keys in a dict. It renders like [a,b,c].
+type keyOrder []string
+
+func (k keyOrder) String() string {
+	return "[" + strings.Join(k, ",") + "]"
+}
+
+// xmlKeyOrders maps the paths of the dicts in an XML plist to the order of their keys. It returns
+// nil for data that isn't an XML plist.
+func xmlKeyOrders(data []byte) map[string][]string {
+	if len(data) == 0 || isBinaryPlist(data) {
+		return nil
+	}
+	scanner := &xmlLineScanner{
+		data:    data,
+		decoder: xml.NewDecoder(bytes.NewReader(data)),
+		lines:   map[string]int{},
+		keys:    map[string][]string{},
+		line:    1,
+	}
+	err := scanner.scan()
+	if err != nil || len(scanner.lines) == 0 {
+		return nil
+	}
+	return scanner.keys
+}
+
+// isBinaryPlist is true when data starts with the binary plist magic
+func isBinaryPlist(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("bplist"))
+}
+
+// reorderDiffs are pseudo-diffs for the dicts in both aData and bData whose common keys are in a
+// different order. Keys that are only on one side don't count as reordering. Only XML plists
+// have an order to compare.
+func reorderDiffs(aData, bData []byte) plistDiff {
+	aKeys := xmlKeyOrders(aData)
+	bKeys := xmlKeyOrders(bData)
+	if aKeys == nil || bKeys == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(aKeys))
+	for path := range aKeys {
+		if _, ok := bKeys[path]; ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	var delta plistDiff
+	for _, path := range paths {
+		if !reordered(aKeys[path], bKeys[path]) {
+			continue
+		}
+		delta = append(delta, FileDiff{
+			path: "keys reordered in " + path,
+			old:  keyOrder(aKeys[path]),
+			new:  keyOrder(bKeys[path]),
+		})
+	}
+	return delta
+}
+
+// reordered is true when the keys a and b have in common are in a different order.
+func reordered(a, b []string) bool {
+	common := commonKeys(a, b)
+	other := commonKeys(b, a)
+	if len(common) != len(other) {
+		// duplicate keys
+		return true
+	}
+	for i := range common {
+		if common[i] != other[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// commonKeys is the keys in a that are also in b, in a's order.
+func commonKeys(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, key := range b {
+		inB[key] = true
+	}
+	var keys []string
+	for _, key := range a {
+		if inB[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"howett.net/plist"
+)
+
+func TestOrderedDicts(t *testing.T) {
+	xmlDict := func(keys ...string) []byte {
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<plist version="1.0"><dict>`)
+		for _, key := range keys {
+			b.WriteString("<key>" + key + "</key><true/>")
+		}
+		b.WriteString("</dict></plist>\n")
+		return []byte(b.String())
+	}
+	binary, err := plist.Marshal(map[string]interface{}{"a": true, "b": true, "c": true}, plist.BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, td := range []struct {
+		name     string
+		old, new []byte
+		want     string
+		wantLog  string
+	}{
+		{
+			name: "reordered",
+			old:  xmlDict("a", "b", "c"),
+			new:  xmlDict("b", "a", "c"),
+			want: "keys reordered in root: [a,b,c] → [b,a,c]",
+		},
+		{
+			name: "same order",
+			old:  xmlDict("a", "b", "c"),
+			new:  xmlDict("a", "b", "c"),
+		},
+		{
+			name: "added key",
+			old:  xmlDict("a", "c"),
+			new:  xmlDict("a", "b", "c"),
+		},
+		{
+			name:    "binary",
+			old:     xmlDict("c", "b", "a"),
+			new:     binary,
+			wantLog: "warning: x.plist: --ordered-dicts only compares the key order of XML plists, not binary ones\n",
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			var log bytes.Buffer
+			d := &differ{OrderedDicts: true, Log: newLogger(&log, "warn")}
+			delta, err := d.addReorderDiffs(&filePair{filename: "x.plist", aData: td.old, bData: td.new}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for i := range delta {
+				got = append(got, delta[i].path+": "+formatValue(delta[i].old)+" → "+formatValue(delta[i].new))
+			}
+			if strings.Join(got, "\n") != td.want {
+				t.Errorf("got %q, want %q", got, td.want)
+			}
+			if log.String() != td.wantLog {
+				t.Errorf("log %q, want %q", log.String(), td.wantLog)
+			}
+		})
+	}
+}
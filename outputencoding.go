@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// output encodings for --output-encoding
+const (
+	outputUTF8   = "utf-8"
+	outputEscape = "escape"
+	outputASCII  = "ascii"
+)
+
+// asciiWriter writes to w with runes outside of ASCII escaped like \u00e9 or replaced with ?. Runes
+// outside the basic multilingual plane are escaped as UTF-16 surrogate pairs like JSON does, so
+// escaped JSON output is still valid JSON.
+type asciiWriter struct {
+	w      io.Writer
+	escape bool
+	// pending is the start of a rune that was split between writes
+	pending []byte
+}
+
+// newOutputWriter returns w wrapped for encoding, which is one of outputUTF8, outputEscape or
+// outputASCII.
+func newOutputWriter(w io.Writer, encoding string) io.Writer {
+	if encoding == "" || encoding == outputUTF8 {
+		return w
+	}
+	return &asciiWriter{
+		w:      w,
+		escape: encoding == outputEscape,
+	}
+}
+
+func (a *asciiWriter) Write(p []byte) (int, error) {
+	data := append(a.pending, p...)
+	a.pending = nil
+	end := len(data)
+	// hold back a rune that isn't complete yet
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+		if !utf8.FullRune(data[i:]) {
+			end = i
+		}
+		break
+	}
+	a.pending = append(a.pending, data[end:]...)
+	buf := make([]byte, 0, end)
+	for i := 0; i < end; {
+		r, size := utf8.DecodeRune(data[i:end])
+		i += size
+		if r < utf8.RuneSelf {
+			buf = append(buf, byte(r))
+			continue
+		}
+		buf = append(buf, a.encodeRune(r)...)
+	}
+	_, err := a.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encodeRune is the replacement for a rune outside of ASCII
+func (a *asciiWriter) encodeRune(r rune) string {
+	if !a.escape {
+		return "?"
+	}
+	if r > 0xFFFF {
+		r1, r2 := utf16.EncodeRune(r)
+		return fmt.Sprintf(`\u%04x\u%04x`, r1, r2)
+	}
+	return fmt.Sprintf(`\u%04x`, r)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// keys with special meanings in overlays
+const (
+	// overlayDelete is a list of the dict keys or array indexes to remove
+	overlayDelete = "$delete"
+	// overlayArray marks a patch for an array. Its other keys are indexes.
+	overlayArray = "$array"
+	// overlayInsert is a dict of indexes to values to insert in an array
+	overlayInsert = "$insert"
+	// overlayDeleteFile marks a file that was removed
+	overlayDeleteFile = "$deleteFile"
+)
+
+// escapeOverlayKey escapes a dict key from a plist for an overlay. Keys that start with $ get
+// another $ in front, like $$delete for a key named $delete, so they aren't taken for the keys above.
+func escapeOverlayKey(key string) string {
+	if strings.HasPrefix(key, "$") {
+		return "$" + key
+	}
+	return key
+}
+
+// unescapeOverlayKey reverses escapeOverlayKey
+func unescapeOverlayKey(key string) string {
+	if strings.HasPrefix(key, "$$") {
+		return key[1:]
+	}
+	return key
+}
+
+// escapeOverlayValue escapes the keys of dicts in v for an overlay. Dicts are merged as patches, but
+// arrays and everything in them are used as they are.
+func escapeOverlayValue(v interface{}) interface{} {
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	escaped := make(map[string]interface{}, len(dict))
+	for key, val := range dict {
+		escaped[escapeOverlayKey(key)] = escapeOverlayValue(val)
+	}
+	return escaped
+}
+
+// overlay renders diff as an XML plist dict of filenames to patches that turn the old version of
+// each file into the new one. See applyOverlay for the patch format.
+func (f *formatter) overlay(diff fsDiff) string {
+	patches := map[string]interface{}{}
+	for _, filename := range f.filenames(diff) {
+		if diff[filename].changes() == 0 {
+			continue
+		}
+		patch, ok := overlayPatch(diff[filename])
+		if !ok {
+			f.Log.warnf("%s is left out of the overlay because it could not be parsed as a plist", filename)
+			continue
+		}
+		patches[filename] = patch
+	}
+	out, err := plist.MarshalIndent(patches, plist.XMLFormat, "\t")
+	if err != nil {
+		return fmt.Sprintf("<!-- can't write overlay: %s -->\n", xmlComment(err.Error()))
+	}
+	return string(out) + "\n"
+}
+
+// overlayPatch builds the patch for the diffs of one file. It is false when the file couldn't be
+// parsed.
+func overlayPatch(diffs plistDiff) (interface{}, bool) {
+	root := map[string]interface{}{}
+	for i := range diffs {
+		d := &diffs[i]
+		if d.equal || d.keys == nil {
+			continue
+		}
+		if d.old == plistUnparseable || d.new == plistUnparseable {
+			return nil, false
+		}
+		if len(d.keys) == 0 {
+			if d.new == plistMissing {
+				return map[string]interface{}{overlayDeleteFile: true}, true
+			}
+			return escapeOverlayValue(d.new), true
+		}
+		if _, isIndex := d.keys[0].(int); isIndex {
+			// the plist is an array
+			root[overlayArray] = true
+		}
+		node := root
+		for j, key := range d.keys[:len(d.keys)-1] {
+			node = overlayChild(node, key, d.keys[j+1])
+		}
+		last := d.keys[len(d.keys)-1]
+		name := escapeOverlayKey(fmt.Sprint(last))
+		_, isIndex := last.(int)
+		switch {
+		case d.new == nil:
+			// $delete lists keys as they are in the plist
+			list, _ := node[overlayDelete].([]interface{})
+			node[overlayDelete] = append(list, fmt.Sprint(last))
+		case d.old == nil && isIndex:
+			inserts, ok := node[overlayInsert].(map[string]interface{})
+			if !ok {
+				inserts = map[string]interface{}{}
+				node[overlayInsert] = inserts
+			}
+			inserts[name] = escapeOverlayValue(d.new)
+		default:
+			node[name] = escapeOverlayValue(d.new)
+		}
+	}
+	return root, true
+}
+
+// overlayChild returns the patch for key in node, creating it when needed. next is the key after
+// key, which decides whether the patch is for a dict or an array.
+func overlayChild(node map[string]interface{}, key, next interface{}) map[string]interface{} {
+	name := escapeOverlayKey(fmt.Sprint(key))
+	child, ok := node[name].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		if _, isIndex := next.(int); isIndex {
+			child[overlayArray] = true
+		}
+		node[name] = child
+	}
+	return child
+}
+
+// applyOverlay returns target with patch applied. A patch that isn't a dict replaces target. A dict
+// patch is merged into target: its keys, unescaped with unescapeOverlayKey, are set to their values
+// merged into the values in target, and the keys listed in $delete are removed. A dict with $array set patches an array instead. The
+// indexes in $delete refer to the old array and are removed first, then the other indexes, which
+// refer to the new array, are replaced or, for the ones in $insert, inserted in order.
+func applyOverlay(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	if p[overlayArray] == true {
+		arr, _ := target.([]interface{})
+		return applyArrayOverlay(arr, p)
+	}
+	m, _ := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(m))
+	for key, val := range m {
+		result[key] = val
+	}
+	deletes, _ := p[overlayDelete].([]interface{})
+	for _, key := range deletes {
+		if s, ok := key.(string); ok {
+			delete(result, s)
+		}
+	}
+	for key, val := range p {
+		if key == overlayDelete {
+			continue
+		}
+		key = unescapeOverlayKey(key)
+		result[key] = applyOverlay(result[key], val)
+	}
+	return result
+}
+
+// overlayOp is a change to one array index
+type overlayOp struct {
+	index  int
+	value  interface{}
+	insert bool
+}
+
+func applyArrayOverlay(arr []interface{}, p map[string]interface{}) []interface{} {
+	result := append([]interface{}{}, arr...)
+	deletes, _ := p[overlayDelete].([]interface{})
+	var indexes []int
+	for _, key := range deletes {
+		s, _ := key.(string)
+		i, err := strconv.Atoi(s)
+		if err == nil && i >= 0 && i < len(result) {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	for _, i := range indexes {
+		result = append(result[:i], result[i+1:]...)
+	}
+	var ops []overlayOp
+	for key, val := range p {
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 {
+			ops = append(ops, overlayOp{index: i, value: val})
+		}
+	}
+	inserts, _ := p[overlayInsert].(map[string]interface{})
+	for key, val := range inserts {
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 {
+			ops = append(ops, overlayOp{index: i, value: val, insert: true})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].index < ops[j].index
+	})
+	for _, op := range ops {
+		switch {
+		case op.index >= len(result):
+			result = append(result, applyOverlay(nil, op.value))
+		case op.insert:
+			result = append(result[:op.index], append([]interface{}{applyOverlay(nil, op.value)}, result[op.index:]...)...)
+		default:
+			result[op.index] = applyOverlay(result[op.index], op.value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// path styles for formatter.PathStyle
+const (
+	pathStyleCmp        = "cmp"
+	pathStylePlistBuddy = "plistbuddy"
+	pathStyleJSONPath   = "jsonpath"
+)
+
+// pathKeys returns the dict keys (strings) and array indexes (ints) along pa.
+func pathKeys(pa cmp.Path) []interface{} {
+	keys := []interface{}{}
+	for _, s := range pa {
+		switch s := s.(type) {
+		case cmp.MapIndex:
+			keys = append(keys, s.Key().Interface())
+		case cmp.SliceIndex:
+			ix, iy := s.SplitKeys()
+			if iy >= 0 {
+				keys = append(keys, iy)
+			} else {
+				keys = append(keys, ix)
+			}
+		}
+	}
+	return keys
+}
+
+// diffPath renders the path of d in PathStyle.
+func (f *formatter) diffPath(d *FileDiff) string {
+	return f.keyPath(d.path, d.keys)
+}
+
+// keyPath renders keys in PathStyle. path is the cmp style path and is used as is for pseudo-diffs
+// like mtime that don't have keys.
+func (f *formatter) keyPath(path string, keys []interface{}) string {
+	if keys == nil {
+		return path
+	}
+	switch f.PathStyle {
+	case pathStylePlistBuddy:
+		return plistBuddyPath(keys)
+	case pathStyleJSONPath:
+		return jsonPath(keys)
+	default:
+		return path
+	}
+}
+
+// plistBuddyPath renders keys like :Foo:Bar:0 for PlistBuddy.
+func plistBuddyPath(keys []interface{}) string {
+	if len(keys) == 0 {
+		return ":"
+	}
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(":")
+		switch key := key.(type) {
+		case string:
+			b.WriteString(key)
+		case int:
+			b.WriteString(strconv.Itoa(key))
+		}
+	}
+	return b.String()
+}
+
+var jsonPathIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonPath renders keys like $.Foo.Bar[0]. Keys that aren't identifiers use bracket notation.
+func jsonPath(keys []interface{}) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, key := range keys {
+		switch key := key.(type) {
+		case string:
+			if jsonPathIdent.MatchString(key) {
+				b.WriteString("." + key)
+				continue
+			}
+			b.WriteString("['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key) + "']")
+		case int:
+			b.WriteString("[" + strconv.Itoa(key) + "]")
+		}
+	}
+	return b.String()
+}
@@ -1,216 +1,1484 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/gosuri/uilive"
-	"github.com/psanford/memfs"
 	"howett.net/plist"
 )
 
-type fsDiff map[string]fmt.Stringer
+type fsDiff map[string]plistDiff
 
 func (f fsDiff) String() string {
+	return (&formatter{}).format(f)
+}
+
+// Digest is a hex encoded sha256 hash of the diffs. It is the same for identical diffs.
+func (f fsDiff) Digest() string {
 	filenames := make([]string, 0, len(f))
 	for filename := range f {
 		filenames = append(filenames, filename)
 	}
 	sort.Strings(filenames)
-	var s string
+	h := sha256.New()
 	for _, filename := range filenames {
-		s += fmt.Sprintf("%s:\n%s\n\n", filename, f[filename])
+		fmt.Fprintf(h, "%q\n", filename)
+		for _, d := range f[filename] {
+			fmt.Fprintf(h, "%q %t %T %q %T %q\n", d.path, d.equal, d.old, formatValue(d.old), d.new, formatValue(d.new))
+		}
 	}
-	return s
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// changes is the number of differences in all files
+func (f fsDiff) changes() int {
+	n := 0
+	for _, p := range f {
+		n += p.changes()
+	}
+	return n
+}
+
+// plistDiff is all the differences found in one file
+type plistDiff []FileDiff
+
+func (p plistDiff) String() string {
+	return (&formatter{}).fileText(p)
+}
+
+// changes is the number of entries that are differences rather than equal values
+func (p plistDiff) changes() int {
+	n := 0
+	for i := range p {
+		if !p[i].equal {
+			n++
+		}
+	}
+	return n
+}
+
+// kinds of change for --fail-on
+const (
+	changeAny     = "any"
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// changeKind is changeAdded, changeRemoved or changeChanged. Added and removed files count as added
+// and removed.
+func (d *FileDiff) changeKind() string {
+	switch {
+	case d.old == nil || d.old == plistMissing:
+		return changeAdded
+	case d.new == nil || d.new == plistMissing:
+		return changeRemoved
+	default:
+		return changeChanged
+	}
+}
+
+// hasChange reports whether any file in d has a change of the given kind. changeAny matches every change.
+func (d fsDiff) hasChange(kind string) bool {
+	for _, p := range d {
+		for i := range p {
+			if p[i].equal {
+				continue
+			}
+			if kind == changeAny || p[i].changeKind() == kind {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type differ struct {
 	IgnorePermissionError bool
 	IgnoreTimestamps      bool
+	// AssumeFormat is the plist format to decode files as. plist.AutomaticFormat detects it.
+	AssumeFormat int
+	// SourceLocations adds the line numbers where diffs are found to diffs from XML plists.
+	SourceLocations bool
+	// IgnoreEmptyChanges leaves out changes between empty values like "" and a missing key.
+	IgnoreEmptyChanges bool
+	// AbsentBoolFalse leaves out changes between a missing dict key and false.
+	AbsentBoolFalse bool
+	// CounterWindow leaves out changes where an integer increases by no more than this much when it
+	// is above 0.
+	CounterWindow uint64
+	// FuzzyKeys reports a dict key that is removed while a key in the same dict that only differs by
+	// case, underscores, hyphens or spaces is added as a rename.
+	FuzzyKeys bool
+	// RawOnDecodeFailure compares the bytes of plists that both fail to decode instead of
+	// treating them as equal.
+	RawOnDecodeFailure bool
+	// ShowEqual includes values that are equal on both sides in diffs.
+	ShowEqual bool
+	// WhereKey is a key path that plists must have to be compared. Plists without it are treated as
+	// missing. No key path means all plists are compared.
+	WhereKey []string
+	// IgnoreKeys are dict keys to leave out of comparisons no matter where they appear.
+	IgnoreKeys []string
+	// OnChange is called by watch with the changed filenames whenever the changes differ from the previous tick.
+	OnChange func(filenames []string)
+	// DigestOut gets the digest of the changes from watch each time they change.
+	DigestOut io.Writer
+	// Intersection only compares files that are in both trees.
+	Intersection bool
+	// Context is the number of unchanged sibling dict entries to show on each side of a change.
+	Context int
+	// CheckMTime reports modification time changes on files with identical content.
+	CheckMTime bool
+	// Live redraws watch output in place. Otherwise changes are appended to the output.
+	Live bool
+	// RelativeTime labels the changes watch appends with the time since it started instead of the
+	// time of day.
+	RelativeTime bool
+	// Summary makes watch output a one line summary of the changes instead of the changes.
+	Summary bool
+	// WatchChecksum makes watch hash every file on each tick instead of only reading files whose
+	// modification time or size changed.
+	WatchChecksum bool
+	// UntilChange makes watch return after it reports the first changes.
+	UntilChange bool
+	// Settle is how long watch waits after seeing a change to read the tree again and report the
+	// changes. This keeps files that are written in several steps from being reported mid-write.
+	Settle time.Duration
+	// FileFilter decides which regular files are compared. Defaults to isPlistFile.
+	FileFilter func(path string, info fs.FileInfo) bool
+	// Files restricts comparisons to exactly these paths when it isn't empty. FileFilter is not
+	// consulted for them.
+	Files map[string]bool
+	// SkipFiles are base names of files to leave out of comparisons and snapshots, even when they are in Files.
+	SkipFiles map[string]bool
+	// RequireFiles are paths that must be in both trees.
+	RequireFiles []string
+	// IgnoreMissing allows paths in Files that are in neither tree.
+	IgnoreMissing bool
+	// CoerceSingletons treats a single-element array as equal to the value it contains.
+	CoerceSingletons bool
+	// ReferencePaths limit comparisons to the values at, under or above these key paths when it
+	// isn't empty.
+	ReferencePaths [][]interface{}
+	// Defaults are the default values of dict keys. Adding or removing a key that holds its default
+	// value isn't a change.
+	Defaults map[string]interface{}
+	// IgnoreRules ignore changes at key paths in specific files.
+	IgnoreRules []ignoreRule
+	// CompareRules set how values at specific key paths are compared. They take precedence over
+	// NumericThreshold.
+	CompareRules []compareRule
+	// TransformRules rewrite string values at specific key paths before they are compared.
+	TransformRules []transformRule
+	// DecodeNestedData compares data values that are themselves plists by their decoded values.
+	DecodeNestedData bool
+	// NormalizeObjects compares keyed archives with $objects in a canonical order.
+	NormalizeObjects bool
+	// MaxNesting is how deeply dicts and arrays may be nested in the plists being compared. Deeper
+	// plists are an error. 0 means no limit.
+	MaxNesting int
+	// SkipLargeData ignores changes to data values that are more than this many bytes on either side
+	// when it is above 0.
+	SkipLargeData int
+	// NumericThreshold treats numbers that are no more than this far apart as equal when it is above 0.
+	NumericThreshold float64
+	// NumericThresholdPaths limits NumericThreshold to values whose key paths match one of these
+	// path.Match patterns. Key paths are the dict keys and array indexes joined with /.
+	NumericThresholdPaths []string
+	// IgnoreUUIDs treats two strings that both look like UUIDs as equal.
+	IgnoreUUIDs bool
+	// IgnoreUUIDsPaths limits IgnoreUUIDs to values whose key paths match one of these path.Match
+	// patterns like NumericThresholdPaths.
+	IgnoreUUIDsPaths []string
+	// ShowSize adds the file sizes to the diffs of files with changes.
+	ShowSize bool
+	// Canonical compares plists re-encoded by canonicalPlist as XML instead of as they are. Plists that
+	// can't be decoded are compared as they are.
+	Canonical bool
+	// OrderedDicts reports dicts whose keys are in a different order. Only XML plists are checked.
+	OrderedDicts bool
+	// ByteDiff adds a pseudo-diff with the first differing byte of files that have equal values but
+	// different bytes.
+	ByteDiff bool
+	// CountKeys adds an equal keys pseudo-diff with the number of values in the file to the diffs of
+	// files with changes.
+	CountKeys bool
+	// SizeOnlyChanges also reports size changes of files whose content is the same. Requires ShowSize.
+	SizeOnlyChanges bool
+	// Streaming compares trees by walking them side by side instead of listing all of their files
+	// first.
+	Streaming bool
+	// Since is the snapshot watch compares to. When it is nil, watch takes a snapshot when it starts.
+	Since *memFS
+	// StripComponents is the number of leading directories to remove from the paths in archives.
+	StripComponents int
+	// FetchTimeout limits how long getFS waits to download a URL. 0 means no limit.
+	FetchTimeout time.Duration
+	// Options are extra cmp.Options for comparing decoded plists. They are passed after the built-in
+	// options. As with any cmp.Options, an Ignore wins over other options, and more than one Comparer or
+	// Transformer applying to the same values makes cmp panic.
+	Options []cmp.Option
+	// Log gets diagnostic messages like skipped files. It may be nil.
+	Log *logger
+	// FilesCompared counts the files that diffFSFilename found in either tree.
+	FilesCompared int
+	// BytesRead counts the bytes of the files read while comparing.
+	BytesRead int64
 }
 
-func (d *differ) diff(a, b string) (bool, fsDiff, error) {
-	fsA, err := getFS(a)
+// isPlistFile is the default FileFilter. It matches files with a .plist extension.
+func isPlistFile(path string, _ fs.FileInfo) bool {
+	return strings.HasSuffix(path, ".plist")
+}
+
+func (d *differ) includeFile(path string, dir fs.DirEntry) (bool, error) {
+	if d.SkipFiles[dir.Name()] {
+		return false, nil
+	}
+	if len(d.Files) > 0 {
+		return d.Files[path], nil
+	}
+	filter := d.FileFilter
+	if filter == nil {
+		filter = isPlistFile
+	}
+	info, err := dir.Info()
 	if err != nil {
-		return false, nil, err
+		return false, err
 	}
-	fsB, err := getFS(b)
+	return filter(path, info), nil
+}
+
+func (d *differ) diff(a, b string) (bool, fsDiff, error) {
+	trees, err := d.getFSs(a, b)
 	if err != nil {
 		return false, nil, err
 	}
-	return d.diffFS(fsA, fsB)
+	return d.diffFS(trees[0], trees[1])
 }
 
-func (d *differ) watch(a string, stdout io.Writer) error {
-	ticker := time.Tick(2 * time.Second)
-	fsA, err := getFS(a)
-	if err != nil {
-		return err
+// watch reports changes to the tree at a until ctx is done.
+func (d *differ) watch(ctx context.Context, a string, stdout io.Writer, f *formatter) error {
+	snap := d.Since
+	if snap == nil {
+		fsA, err := d.getFS(a)
+		if err != nil {
+			return err
+		}
+		snap, err = d.plSnapshot(fsA)
+		if err != nil {
+			return err
+		}
 	}
-	snap, err := d.plSnapshot(fsA)
-	if err != nil {
-		return err
+	switch {
+	case d.Summary:
+		return d.watchSummary(ctx, snap, a, stdout, f)
+	case f.Format == formatJSONL:
+		return d.watchJSONL(ctx, snap, a, stdout, f)
+	case f.Format == formatText && isRegularFile(a):
+		return d.watchFile(ctx, snap, a, stdout, f)
+	case d.Live:
+		return d.watchLive(ctx, snap, a, stdout, f)
+	default:
+		return d.watchAppend(ctx, snap, a, stdout, f)
+	}
+}
+
+// watchInterval is how often watch reads the tree
+var watchInterval = 2 * time.Second
+
+// watchTicks compares the tree at a to snap every watchInterval and calls fn with the result. changed
+// is true when the diff is different from the previous tick. The whole tree is walked on each tick,
+// so files in directories created after the watch started are picked up without registering them.
+// It returns nil when ctx is done.
+func (d *differ) watchTicks(ctx context.Context, snap fs.FS, a string, f *formatter, fn func(diff fsDiff, changed bool) error) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	cache := newDiffCache(a, d.WatchChecksum)
+	var last string
+	for {
+		if !waitTick(ctx, ticker) {
+			return nil
+		}
+		diff, err := d.diffSnapshot(snap, a, cache)
+		if err != nil {
+			return err
+		}
+		out := diff.Digest()
+		changed := out != last
+		d.Log.debugf("read %s: %d changes", a, diff.changes())
+		if changed && d.Settle > 0 {
+			d.Log.debugf("waiting %s for %s to settle", d.Settle, a)
+			// give the writer time to finish before reporting
+			time.Sleep(d.Settle)
+			diff, err = d.diffSnapshot(snap, a, cache)
+			if err != nil {
+				return err
+			}
+			out = diff.Digest()
+		}
+		err = fn(diff, changed)
+		if err != nil {
+			return err
+		}
+		if changed {
+			d.notifyChanges(f, diff, out)
+		}
+		if d.UntilChange && diff.changes() > 0 {
+			return nil
+		}
+		last = out
 	}
+}
+
+// watchLive redraws the changes in place on every tick.
+func (d *differ) watchLive(ctx context.Context, snap fs.FS, a string, stdout io.Writer, f *formatter) error {
 	writer := uilive.New()
 	writer.Out = stdout
 	writer.RefreshInterval = time.Second
 	writer.Start()
 	defer writer.Stop()
-	i := 0
+	return d.watchTicks(ctx, snap, a, f, func(diff fsDiff, _ bool) error {
+		var events map[string]string
+		if f.fileEvents() {
+			events, diff = splitFileEvents(diff)
+		}
+		_, err := fmt.Fprintln(writer, fileEventsText(events, nil)+f.format(diff))
+		return err
+	})
+}
+
+// file events for watch
+const (
+	fileAdded   = "added"
+	fileRemoved = "removed"
+)
+
+// fileEvents is true for formats where watch reports added and removed files as events instead of
+// listing their contents.
+func (f *formatter) fileEvents() bool {
+	return (f.Format == formatText || f.Format == formatColumns) && !f.NameOnly && !f.Schema && !f.Stats
+}
+
+// splitFileEvents separates the files in diff that were added or removed from the files whose
+// content changed. events maps filenames to fileAdded or fileRemoved.
+func splitFileEvents(diff fsDiff) (map[string]string, fsDiff) {
+	events := map[string]string{}
+	rest := fsDiff{}
+	for filename, fileDiff := range diff {
+		event := ""
+		for i := range fileDiff {
+			switch {
+			case fileDiff[i].old == plistMissing:
+				event = fileAdded
+			case fileDiff[i].new == plistMissing:
+				event = fileRemoved
+			}
+		}
+		if event == "" {
+			rest[filename] = fileDiff
+			continue
+		}
+		events[filename] = event
+	}
+	return events, rest
+}
+
+// fileEventsText renders a line like "file removed: foo.plist" for each event that isn't the same
+// in reported.
+func fileEventsText(events, reported map[string]string) string {
+	filenames := make([]string, 0, len(events))
+	for filename := range events {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	var s string
+	for _, filename := range filenames {
+		if events[filename] != reported[filename] {
+			s += fmt.Sprintf("file %s: %s\n", events[filename], filename)
+		}
+	}
+	return s
+}
+
+// watchSummary writes a one line summary of the changes instead of the changes themselves. It is
+// redrawn in place when d.Live is set. Otherwise a line is appended whenever the changes change.
+func (d *differ) watchSummary(ctx context.Context, snap fs.FS, a string, stdout io.Writer, f *formatter) error {
+	out := stdout
+	if d.Live {
+		writer := uilive.New()
+		writer.Out = stdout
+		writer.RefreshInterval = time.Second
+		writer.Start()
+		defer writer.Stop()
+		out = writer
+	}
+	var lastChange time.Time
+	return d.watchTicks(ctx, snap, a, f, func(diff fsDiff, changed bool) error {
+		// the first tick is always "changed", but it's only a change when there are changes
+		if changed && (diff.changes() > 0 || !lastChange.IsZero()) {
+			lastChange = time.Now()
+		}
+		if !changed && !d.Live {
+			return nil
+		}
+		_, err := fmt.Fprintln(out, f.summary(diff, lastChange))
+		return err
+	})
+}
+
+// watchAppend writes the changes with a timestamp whenever they are different from the previous
+// tick. It is for output that isn't a terminal. Files that are added or removed are reported once
+// when it happens rather than with their contents every time.
+func (d *differ) watchAppend(ctx context.Context, snap fs.FS, a string, stdout io.Writer, f *formatter) error {
+	reported := map[string]string{}
+	start := time.Now()
+	return d.watchTicks(ctx, snap, a, f, func(diff fsDiff, changed bool) error {
+		if !changed {
+			return nil
+		}
+		stamp := time.Now().Format(time.RFC3339)
+		if d.RelativeTime {
+			stamp = relativeTime(time.Since(start))
+		}
+		_, err := fmt.Fprintf(stdout, "[%s]\n", stamp)
+		if err != nil {
+			return err
+		}
+		events := map[string]string{}
+		if f.fileEvents() {
+			events, diff = splitFileEvents(diff)
+		}
+		_, err = io.WriteString(stdout, fileEventsText(events, reported))
+		if err != nil {
+			return err
+		}
+		reported = events
+		switch {
+		case len(diff) > 0:
+			return f.write(stdout, diff)
+		case len(events) > 0:
+			_, err = io.WriteString(stdout, "\n")
+		default:
+			_, err = io.WriteString(stdout, "no changes\n\n")
+		}
+		return err
+	})
+}
+
+// relativeTime formats elapsed to a tenth of a second like +00:02.5, or +1:00:02.5 past an hour.
+func relativeTime(elapsed time.Duration) string {
+	tenths := elapsed / (100 * time.Millisecond)
+	hours := tenths / 36000
+	minutes := tenths / 600 % 60
+	seconds := tenths / 10 % 60
+	if hours > 0 {
+		return fmt.Sprintf("+%d:%02d:%02d.%d", hours, minutes, seconds, tenths%10)
+	}
+	return fmt.Sprintf("+%02d:%02d.%d", minutes, seconds, tenths%10)
+}
+
+// watchJSONL is watch for formatJSONL. Instead of redrawing all changes, it writes a line for each
+// file with changes that are different from the previous tick. A file that no longer differs from
+// the snapshot gets a line with no diffs.
+func (d *differ) watchJSONL(ctx context.Context, snap fs.FS, a string, stdout io.Writer, f *formatter) error {
+	last := map[string]string{}
+	return d.watchTicks(ctx, snap, a, f, func(diff fsDiff, _ bool) error {
+		changed := fsDiff{}
+		current := make(map[string]string, len(diff))
+		for filename, fileDiff := range diff {
+			current[filename] = fileDiff.String()
+			if current[filename] != last[filename] {
+				changed[filename] = fileDiff
+			}
+		}
+		for filename := range last {
+			if _, ok := current[filename]; !ok {
+				changed[filename] = plistDiff{}
+			}
+		}
+		last = current
+		if len(changed) == 0 {
+			return nil
+		}
+		_, err := io.WriteString(stdout, f.format(changed))
+		return err
+	})
+}
+
+// watchFile is watch for a single file. Instead of showing the changes from the start, it logs each
+// change from the previous tick as it happens.
+func (d *differ) watchFile(ctx context.Context, snap *memFS, a string, stdout io.Writer, f *formatter) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
 	for {
-		i++
-		<-ticker
-		fsA, err = getFS(a)
+		if !waitTick(ctx, ticker) {
+			return nil
+		}
+		diff, next, err := d.diffNext(snap, a)
 		if err != nil {
 			return err
 		}
-		_, diff, err := d.diffFS(snap, fsA)
+		if len(diff) > 0 && d.Settle > 0 {
+			// give the writer time to finish before reporting
+			time.Sleep(d.Settle)
+			diff, next, err = d.diffNext(snap, a)
+			if err != nil {
+				return err
+			}
+		}
+		if len(diff) == 0 {
+			continue
+		}
+		err = f.writeChangeLog(stdout, diff, time.Now())
 		if err != nil {
 			return err
 		}
-		fmt.Fprintln(writer, diff)
+		d.notifyChanges(f, diff, diff.Digest())
+		if d.UntilChange {
+			return nil
+		}
+		snap = next
+	}
+}
+
+// waitTick waits for the next tick from ticker. It returns false when ctx is done first.
+func waitTick(ctx context.Context, ticker *time.Ticker) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-ticker.C:
+		return true
+	}
+}
+
+// notifyChanges runs --on-change and writes the --digest hash when watch sees new changes. digest is
+// the hash of diff.
+func (d *differ) notifyChanges(f *formatter, diff fsDiff, digest string) {
+	if len(diff) > 0 && d.OnChange != nil {
+		d.OnChange(f.filenames(diff))
+	}
+	if d.DigestOut != nil {
+		fmt.Fprintln(d.DigestOut, digest)
+	}
+}
+
+// writeChangeLog writes a line for each change in diff labeled with now.
+func (f *formatter) writeChangeLog(w io.Writer, diff fsDiff, now time.Time) error {
+	stamp := now.Format(time.RFC3339)
+	for _, filename := range f.filenames(diff) {
+		for _, fd := range diff[filename] {
+			if fd.equal {
+				continue
+			}
+			_, err := fmt.Fprintf(w, "[%s] %s: %s → %s\n", stamp, f.diffPath(&fd), f.historyValue(fd.old), f.historyValue(fd.new))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffNext compares snap to a new snapshot of the tree at a and returns both the diff and the new snapshot.
+func (d *differ) diffNext(snap *memFS, a string) (fsDiff, *memFS, error) {
+	fsA, err := d.getFS(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err := d.plSnapshot(fsA)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, diff, err := d.diffFS(snap, next)
+	if err != nil {
+		return nil, nil, err
+	}
+	return diff, next, nil
+}
+
+// isRegularFile is true when path expands to a regular file.
+func isRegularFile(path string) bool {
+	path, err := expandPath(path)
+	if err != nil {
+		return false
+	}
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode().IsRegular()
+}
+
+// diffSnapshot compares snap to the current state of the tree at a. When cache isn't nil, only files
+// that changed since the last call with the same cache are decoded and compared.
+func (d *differ) diffSnapshot(snap fs.FS, a string, cache *diffCache) (fsDiff, error) {
+	fsA, err := d.getFS(a)
+	if err != nil {
+		return nil, err
+	}
+	_, diff, err := d.diffFSCached(snap, fsA, cache)
+	return diff, err
+}
+
+// watchOnce snapshots a, waits for a line on stdin, then writes the changes since the snapshot to stdout.
+func (d *differ) watchOnce(a string, stdin io.Reader, stdout, stderr io.Writer, f *formatter) error {
+	fsA, err := d.getFS(a)
+	if err != nil {
+		return err
+	}
+	snap, err := d.plSnapshot(fsA)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stderr, "baseline captured, make your change and press Enter")
+	_, err = bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	diff, err := d.diffSnapshot(snap, a, nil)
+	if err != nil {
+		return err
+	}
+	return f.write(stdout, diff)
+}
+
+// expandPath expands environment variables and a leading ~ in path.
+func expandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return home + path[1:], nil
+}
+
+// singleFileName is the name of a single file when there is no base name to use
+const singleFileName = "single-file.plist"
+
+// singleFileKey is the name a single file or URL gets in the fs.FS from getFS. It is the base name
+// with .plist added when it doesn't already end in .plist. A file's diffs are keyed the same whether
+// it is given by itself or found in a directory.
+func singleFileKey(name string) string {
+	if isURL(name) {
+		u, err := url.Parse(name)
+		if err != nil {
+			return singleFileName
+		}
+		name = u.Path
+	}
+	base := path.Base(filepath.ToSlash(name))
+	if base == "." || base == "/" {
+		return singleFileName
+	}
+	if !strings.HasSuffix(base, ".plist") {
+		base += ".plist"
+	}
+	return base
+}
+
+// isSingleFile is true when getFS returns a single file for name
+func isSingleFile(name string) bool {
+	return isURL(name) || isRegularFile(name) && !isArchive(name)
+}
+
+// getFSs calls getFS for each of paths. When they are all single files, they all get the key of the
+// first one so that they are compared to each other.
+func (d *differ) getFSs(paths ...string) ([]fs.FS, error) {
+	key := singleFileKey(paths[0])
+	for _, p := range paths {
+		if !isSingleFile(p) {
+			key = ""
+			break
+		}
+	}
+	trees := make([]fs.FS, len(paths))
+	for i, p := range paths {
+		var err error
+		trees[i], err = d.getFSAs(p, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return trees, nil
+}
+
+// getFS returns an fs.FS for a directory, a single file, a glob or a URL. A single file or URL is
+// named by singleFileKey.
+func (d *differ) getFS(path string) (fs.FS, error) {
+	return d.getFSAs(path, "")
+}
+
+// getFSAs is getFS with the name to give a single file or URL instead of singleFileKey. An empty
+// key uses singleFileKey.
+func (d *differ) getFSAs(path, key string) (fs.FS, error) {
+	if key == "" {
+		key = singleFileKey(path)
+	}
+	if isURL(path) {
+		return d.fetchFS(path, key)
+	}
+	path, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) && isGlob(path) {
+		return globFS(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return os.DirFS(path), nil
+	}
+	if stat.Mode().IsRegular() && isArchive(path) {
+		return d.archiveFS(path)
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is neither a director nor regular file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	val := newMemFS()
+
+	err = val.writeFile(key, data, stat)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globFS returns an fs.FS containing the regular files matching pattern. Files are named by their path
+// relative to the deepest directory containing all matches.
+func globFS(pattern string) (fs.FS, error) {
+	files, err := globFiles(pattern)
+	if err != nil {
+		return nil, err
+	}
+	root := commonDir(files)
+	val := newMemFS()
+	for match, stat := range files {
+		var name string
+		name, err = filepath.Rel(root, match)
+		if err != nil {
+			return nil, err
+		}
+		err = val.copyFile(filepath.ToSlash(name), match, stat)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
+
+// globFiles returns the regular files matching pattern. It is an error for there to be none.
+func globFiles(pattern string) (map[string]fs.FileInfo, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]fs.FileInfo{}
+	for _, match := range matches {
+		var stat fs.FileInfo
+		stat, err = os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		if stat.Mode().IsRegular() {
+			files[match] = stat
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+	return files, nil
+}
+
+// commonDir returns the deepest directory containing all of files
+func commonDir(files map[string]fs.FileInfo) string {
+	root := ""
+	for match := range files {
+		if root == "" {
+			root = filepath.Dir(match)
+		}
+		for !isWithin(root, match) && filepath.Dir(root) != root {
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// isWithin is true when filename is inside dir
+func isWithin(dir, filename string) bool {
+	rel, err := filepath.Rel(dir, filename)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (d *differ) diffFS(a, b fs.FS) (bool, fsDiff, error) {
+	return d.diffFSCached(a, b, nil)
+}
+
+// diffFSCached is diffFS with the diffs of files in b that haven't changed since they were cached
+// taken from cache. cache may be nil.
+func (d *differ) diffFSCached(a, b fs.FS, cache *diffCache) (bool, fsDiff, error) {
+	if d.Streaming {
+		return d.diffFSStreaming(a, b, cache)
+	}
+	err := d.checkRequired(a, b)
+	if err != nil {
+		return false, nil, err
+	}
+
+	aFiles, err := d.getPlistFiles(a)
+	if err != nil {
+		return false, nil, err
+	}
+
+	bFiles, err := d.getPlistFiles(b)
+	if err != nil {
+		return false, nil, err
+	}
+
+	err = d.checkMissing(aFiles, bFiles)
+	if err != nil {
+		return false, nil, err
+	}
+
+	delta := fsDiff{}
+	eq := true
+	for _, filename := range d.comparedFiles(aFiles, bFiles) {
+		var df plistDiff
+		df, err = cache.diffFSFilename(d, a, b, filename)
+		if err != nil {
+			return false, nil, err
+		}
+		if df != nil {
+			delta[filename] = df
+			eq = eq && df.changes() == 0
+		}
+	}
+	return eq, delta, nil
+}
+
+// comparedFiles returns the files from aFiles and bFiles that diffFS compares. With d.Intersection
+// that is the files in both, otherwise it is the files in either.
+func (d *differ) comparedFiles(aFiles, bFiles map[string]struct{}) []string {
+	filenames := make([]string, 0, len(aFiles)+len(bFiles))
+	for filename := range aFiles {
+		if _, ok := bFiles[filename]; ok || !d.Intersection {
+			filenames = append(filenames, filename)
+		}
+	}
+	if d.Intersection {
+		return filenames
+	}
+	for filename := range bFiles {
+		if _, ok := aFiles[filename]; !ok {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames
+}
+
+// checkRequired returns an error when a path in d.RequireFiles is missing from a or b.
+func (d *differ) checkRequired(a, b fs.FS) error {
+	var missing []string
+	for _, filename := range d.RequireFiles {
+		for _, fsys := range []fs.FS{a, b} {
+			_, err := fs.Stat(fsys, filename)
+			if errors.Is(err, fs.ErrNotExist) {
+				missing = append(missing, filename)
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("required files missing: %s", strings.Join(missing, ", "))
+}
+
+// checkMissing returns an error when a path in d.Files is in neither tree.
+func (d *differ) checkMissing(aFiles, bFiles map[string]struct{}) error {
+	if d.IgnoreMissing {
+		return nil
+	}
+	var missing []string
+	for filename := range d.Files {
+		_, inA := aFiles[filename]
+		_, inB := bFiles[filename]
+		if !inA && !inB && !d.SkipFiles[path.Base(filename)] {
+			missing = append(missing, filename)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("not found in either tree: %s", strings.Join(missing, ", "))
+}
+
+func (d *differ) readFile(fsys fs.FS, filename string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	d.BytesRead += int64(len(data))
+	if errors.Is(err, os.ErrPermission) && d.IgnorePermissionError {
+		d.Log.warnOncef("permission:"+filename, "skipping %s: %v", filename, err)
+		return nil, nil
+	}
+	if err == nil && data == nil {
+		// nil means missing
+		data = []byte{}
+	}
+	if err == nil && len(d.WhereKey) > 0 && !d.hasWhereKey(data) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// hasWhereKey is true when data decodes to a plist with WhereKey.
+func (d *differ) hasWhereKey(data []byte) bool {
+	val, err := decodeValue(data, decodeOptions{format: d.AssumeFormat, maxDepth: d.MaxNesting})
+	if err != nil {
+		return false
+	}
+	_, ok := lookupKeyPath(val, d.WhereKey)
+	return ok
+}
+
+func (d *differ) diffFSFilename(a, b fs.FS, filename string) (plistDiff, error) {
+	bData, err := d.readFile(b, filename)
+	if err != nil {
+		return nil, err
+	}
+	return d.diffFSData(a, b, filename, bData)
+}
+
+// diffFSData is diffFSFilename with bData already read from b by d.readFile.
+func (d *differ) diffFSData(a, b fs.FS, filename string, bData []byte) (plistDiff, error) {
+	aData, err := d.readFile(a, filename)
+	if err != nil {
+		return nil, err
+	}
+	if aData != nil || bData != nil {
+		d.FilesCompared++
+	}
+
+	if d.Canonical {
+		aData = d.canonicalData(aData)
+		bData = d.canonicalData(bData)
+	}
+	delta, err := d.diffData(aData, bData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	file := &filePair{a: a, b: b, filename: filename, aData: aData, bData: bData}
+	for _, step := range fileDiffSteps {
+		delta, err = step(d, file, delta)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return delta, nil
+}
+
+// filePair is a file that diffFSFilename compares along with its content in both trees
+type filePair struct {
+	a, b         fs.FS
+	filename     string
+	aData, bData []byte
+}
+
+// fileDiffSteps are applied in order to the diffs of each file compared by diffFSFilename
+var fileDiffSteps = []func(d *differ, file *filePair, delta plistDiff) (plistDiff, error){
+	(*differ).warnUnparseable,
+	(*differ).applyIgnoreRules,
+	(*differ).applyReference,
+	(*differ).dropDefaults,
+	(*differ).addReorderDiffs,
+	(*differ).addMTimeDiff,
+	(*differ).addByteDiff,
+	(*differ).addKeysDiff,
+	(*differ).addSizeDiff,
+}
+
+func (d *differ) warnUnparseable(file *filePair, delta plistDiff) (plistDiff, error) {
+	for i := range delta {
+		if delta[i].old == plistUnparseable || delta[i].new == plistUnparseable {
+			d.Log.warnOncef("unparseable:"+file.filename, "%s could not be parsed as a plist", file.filename)
+		}
+	}
+	return delta, nil
+}
+
+func (d *differ) applyIgnoreRules(file *filePair, delta plistDiff) (plistDiff, error) {
+	if len(d.IgnoreRules) == 0 {
+		return delta, nil
+	}
+	return applyIgnoreRules(d.IgnoreRules, file.filename, delta), nil
+}
+
+func (d *differ) applyReference(_ *filePair, delta plistDiff) (plistDiff, error) {
+	if len(d.ReferencePaths) == 0 {
+		return delta, nil
+	}
+	return applyReference(d.ReferencePaths, delta), nil
+}
+
+func (d *differ) dropDefaults(_ *filePair, delta plistDiff) (plistDiff, error) {
+	if d.Defaults == nil {
+		return delta, nil
+	}
+	return dropDefaults(d.Defaults, delta), nil
+}
+
+func (d *differ) addReorderDiffs(file *filePair, delta plistDiff) (plistDiff, error) {
+	if !d.OrderedDicts {
+		return delta, nil
+	}
+	if isBinaryPlist(file.aData) || isBinaryPlist(file.bData) {
+		d.Log.warnOncef("ordered-dicts:"+file.filename, "%s: --ordered-dicts only compares the key order of XML plists, not binary ones", file.filename)
+		return delta, nil
+	}
+	return append(delta, reorderDiffs(file.aData, file.bData)...), nil
+}
+
+func (d *differ) addMTimeDiff(file *filePair, delta plistDiff) (plistDiff, error) {
+	if !d.CheckMTime || delta.changes() > 0 {
+		return delta, nil
+	}
+	mtime, err := mtimeDiff(file.a, file.b, file.filename)
+	if err != nil || mtime == nil {
+		return delta, err
+	}
+	return append(delta, *mtime), nil
+}
+
+func (d *differ) addByteDiff(file *filePair, delta plistDiff) (plistDiff, error) {
+	if !d.ByteDiff || delta.changes() > 0 || file.aData == nil || file.bData == nil || bytes.Equal(file.aData, file.bData) {
+		return delta, nil
+	}
+	return append(delta, byteDiff(file.aData, file.bData)), nil
+}
+
+func (d *differ) addKeysDiff(file *filePair, delta plistDiff) (plistDiff, error) {
+	if !d.CountKeys || delta.changes() == 0 {
+		return delta, nil
+	}
+	return append(delta, d.keysDiff(file.aData, file.bData)), nil
+}
+
+func (d *differ) addSizeDiff(file *filePair, delta plistDiff) (plistDiff, error) {
+	if !d.ShowSize || delta.changes() == 0 && !(d.SizeOnlyChanges && len(file.aData) != len(file.bData)) {
+		return delta, nil
+	}
+	return append(delta, sizeDiff(file.aData, file.bData)), nil
+}
+
+// dropEmptyChanges removes the diffs where both sides are empty.
+func dropEmptyChanges(delta plistDiff) plistDiff {
+	kept := delta[:0]
+	for _, d := range delta {
+		if !d.equal && isEmpty(d.old) && isEmpty(d.new) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	if len(kept) == 0 {
+		return nil
 	}
+	return kept
 }
 
-func getFS(path string) (fs.FS, error) {
-	stat, err := os.Stat(path)
-	if err != nil {
-		return nil, err
+// dropAbsentFalse removes the diffs where a dict key is missing on one side and false on the other.
+func dropAbsentFalse(delta plistDiff) plistDiff {
+	kept := delta[:0]
+	for _, d := range delta {
+		if !d.equal && isDictKey(d.keys) && (d.old == nil && d.new == false || d.old == false && d.new == nil) {
+			continue
+		}
+		kept = append(kept, d)
 	}
-	if stat.IsDir() {
-		return os.DirFS(path), nil
+	if len(kept) == 0 {
+		return nil
 	}
-	if !stat.Mode().IsRegular() {
-		return nil, fmt.Errorf("%s is neither a director nor regular file", path)
+	return kept
+}
+
+// dropCounterBumps removes the diffs where an integer increases by no more than window.
+func dropCounterBumps(delta plistDiff, window uint64) plistDiff {
+	kept := delta[:0]
+	for _, d := range delta {
+		if !d.equal && isCounterBump(d.old, d.new, window) {
+			continue
+		}
+		kept = append(kept, d)
 	}
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	if len(kept) == 0 {
+		return nil
 	}
-	val := memfs.New()
+	return kept
+}
 
-	err = val.WriteFile("single-file.plist", data, stat.Mode())
-	if err != nil {
-		return nil, err
+// isCounterBump is true when old and new are integers and new is greater than old by no more than
+// window.
+func isCounterBump(old, new interface{}, window uint64) bool {
+	switch old := old.(type) {
+	case uint64:
+		switch new := new.(type) {
+		case uint64:
+			return new > old && new-old <= window
+		}
+	case int64:
+		switch new := new.(type) {
+		case int64:
+			return new > old && uint64(new-old) <= window
+		case uint64:
+			// old is negative since non-negative integers decode as uint64
+			return new <= window && uint64(-(old+1))+1 <= window-new
+		}
 	}
-	return val, nil
+	return false
 }
 
-func (d *differ) diffFS(a, b fs.FS) (bool, fsDiff, error) {
-	delta := map[string]fmt.Stringer{}
+// isDictKey is true when keys ends with a dict key
+func isDictKey(keys []interface{}) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	_, ok := keys[len(keys)-1].(string)
+	return ok
+}
 
-	aFiles, err := getPlistFiles(a)
-	if err != nil {
-		return false, nil, err
+// isEmpty is true for nil, empty strings, empty arrays and empty dicts
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
 	}
+}
 
-	for filename := range aFiles {
-		var df fmt.Stringer
-		df, err = d.diffFSFilename(a, b, filename)
-		if err != nil {
-			return false, nil, err
-		}
-		if df != nil {
-			delta[filename] = df
-		}
+// byteSize is a file size that renders in human-readable units
+type byteSize int64
+
+func (s byteSize) String() string {
+	switch {
+	case s < 1<<10:
+		return fmt.Sprintf("%dB", int64(s))
+	case s < 1<<20:
+		return fmt.Sprintf("%.1fKB", float64(s)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1fMB", float64(s)/(1<<20))
 	}
+}
 
-	bFiles, err := getPlistFiles(b)
-	if err != nil {
-		return false, nil, err
+// keyCount is the number of values in a plist. It renders as a plain number.
+type keyCount int
+
+// keysDiff is an equal pseudo-diff with the number of values in bData, or aData when bData is
+// missing or unparseable.
+func (d *differ) keysDiff(aData, bData []byte) FileDiff {
+	do := decodeOptions{format: d.AssumeFormat, maxDepth: d.MaxNesting}
+	val, err := decodeValue(bData, do)
+	if _, ok := val.(plistState); ok || err != nil {
+		val, _ = decodeValue(aData, do)
 	}
+	return FileDiff{
+		path:  "keys",
+		new:   countKeys(val, &cycleGuard{}),
+		equal: true,
+	}
+}
 
-	for filename := range bFiles {
-		if _, ok := aFiles[filename]; ok {
-			continue
+// countKeys counts the scalar values in v. Empty dicts and arrays count as one value like scalars
+// do, so an array of scalars counts its elements and a scalar counts 1. A missing or unparseable
+// plist has no values. A reference back to a dict or array being counted counts as one value.
+func countKeys(v interface{}, guard *cycleGuard) keyCount {
+	if _, ok := guard.enter(v); !ok {
+		return 1
+	}
+	defer guard.leave(v)
+	switch v := v.(type) {
+	case nil, plistState:
+		return 0
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return 1
 		}
-		d, err := d.diffFSFilename(a, b, filename)
-		if err != nil {
-			return false, nil, err
+		var n keyCount
+		for _, val := range v {
+			n += countKeys(val, guard)
+		}
+		return n
+	case []interface{}:
+		if len(v) == 0 {
+			return 1
 		}
-		if d != nil {
-			delta[filename] = d
+		var n keyCount
+		for _, val := range v {
+			n += countKeys(val, guard)
 		}
+		return n
+	default:
+		return 1
 	}
+}
 
-	return len(delta) == 0, delta, nil
+// sizeDiff is a diff of the sizes of aData and bData. Nil data is a missing file and has no size.
+func sizeDiff(aData, bData []byte) FileDiff {
+	diff := FileDiff{path: "size"}
+	if aData != nil {
+		diff.old = byteSize(len(aData))
+	}
+	if bData != nil {
+		diff.new = byteSize(len(bData))
+	}
+	return diff
 }
 
-func (d *differ) readFile(fsys fs.FS, filename string) ([]byte, error) {
-	data, err := fs.ReadFile(fsys, filename)
-	if errors.Is(err, os.ErrNotExist) {
-		return []byte{}, nil
+// byteContextLen is how many bytes byteDiff shows on each side of the first differing byte
+const byteContextLen = 8
+
+// byteContext is hex encoded bytes around an offset. It renders as is.
+type byteContext string
+
+// byteDiff is a pseudo-diff with the offset of the first byte that differs between aData and bData
+// and the bytes around it on each side.
+func byteDiff(aData, bData []byte) FileDiff {
+	offset := 0
+	for offset < len(aData) && offset < len(bData) && aData[offset] == bData[offset] {
+		offset++
 	}
-	if errors.Is(err, os.ErrPermission) && d.IgnorePermissionError {
-		return []byte{}, nil
+	return FileDiff{
+		path: fmt.Sprintf("byte %d", offset),
+		old:  hexContext(aData, offset),
+		new:  hexContext(bData, offset),
 	}
-	return data, err
 }
 
-func (d *differ) diffFSFilename(a, b fs.FS, filename string) (fmt.Stringer, error) {
-	bData, err := d.readFile(b, filename)
+// hexContext renders the bytes of data around offset as hex with the byte at offset in brackets, or
+// [end] when offset is past the end of data.
+func hexContext(data []byte, offset int) byteContext {
+	start := offset - byteContextLen
+	if start < 0 {
+		start = 0
+	}
+	end := offset + 1 + byteContextLen
+	if end > len(data) {
+		end = len(data)
+	}
+	s := hex.EncodeToString(data[start:offset])
+	if offset < len(data) {
+		s += "[" + hex.EncodeToString(data[offset:offset+1]) + "]" + hex.EncodeToString(data[offset+1:end])
+	} else {
+		s += "[end]"
+	}
+	return byteContext(s)
+}
+
+// mtimeDiff returns a diff of filename's modification times when it exists in both a and b with
+// different modification times.
+func mtimeDiff(a, b fs.FS, filename string) (*FileDiff, error) {
+	aInfo, err := fs.Stat(a, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	aData, err := d.readFile(a, filename)
+	bInfo, err := fs.Stat(b, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	if aInfo.ModTime().Equal(bInfo.ModTime()) {
+		return nil, nil
+	}
+	return &FileDiff{
+		path: "mtime",
+		old:  aInfo.ModTime(),
+		new:  bInfo.ModTime(),
+	}, nil
+}
 
-	var opts []cmp.Option
-	if d.IgnoreTimestamps {
-		opts = append(opts, cmpopts.IgnoreTypes(time.Time{}))
+func (d *differ) diffData(aData, bData []byte) (plistDiff, error) {
+	// Identical bytes always decode to identical values, so skip the decode and compare.
+	// Different bytes still need the full comparison because encodings and whitespace vary.
+	if bytes.Equal(aData, bData) && (aData == nil) == (bData == nil) && !d.ShowEqual {
+		return nil, nil
+	}
+	ro := reportOptions{
+		compareRaw: d.RawOnDecodeFailure,
+		showEqual:  d.ShowEqual,
+		context:    d.Context,
 	}
-	eq, delta, err := diffPlists(aData, bData, opts...)
+	_, delta, err := diffPlists(aData, bData, decodeOptions{format: d.AssumeFormat, maxDepth: d.MaxNesting}, ro, d.cmpOptions()...)
 	if err != nil {
 		return nil, err
 	}
-	if eq {
-		return nil, nil
+	if d.IgnoreEmptyChanges {
+		delta = dropEmptyChanges(delta)
+	}
+	if d.AbsentBoolFalse {
+		delta = dropAbsentFalse(delta)
 	}
-	return stringDiff(delta), nil
+	if d.CounterWindow > 0 {
+		delta = dropCounterBumps(delta, d.CounterWindow)
+	}
+	noteVersionChanges(d.CompareRules, delta)
+	if d.FuzzyKeys {
+		delta = matchRenamedKeys(delta)
+	}
+	if d.SourceLocations {
+		addLines(delta, aData, bData)
+	}
+	return delta, nil
+}
+
+// cmpOptions are the options diffData compares decoded plists with
+func (d *differ) cmpOptions() []cmp.Option {
+	// When timestamps aren't ignored, cmp compares them with time.Time.Equal, so dates that are the
+	// same instant are equal no matter their locations.
+	var opts []cmp.Option
+	for _, opt := range []struct {
+		enabled bool
+		option  func() cmp.Option
+	}{
+		{d.IgnoreTimestamps, func() cmp.Option { return cmpopts.IgnoreTypes(time.Time{}) }},
+		{len(d.IgnoreKeys) > 0, func() cmp.Option { return ignoreKeys(d.IgnoreKeys) }},
+		{d.CoerceSingletons, coerceSingletons},
+		{d.DecodeNestedData, decodeNestedData},
+		{d.NormalizeObjects, normalizeObjects},
+		{d.SkipLargeData > 0, func() cmp.Option { return skipLargeData(d.SkipLargeData) }},
+		{d.NumericThreshold > 0, func() cmp.Option {
+			return numericThreshold(d.NumericThreshold, d.NumericThresholdPaths, d.CompareRules)
+		}},
+		{d.IgnoreUUIDs, func() cmp.Option { return ignoreUUIDs(d.IgnoreUUIDsPaths, d.CompareRules, d.TransformRules) }},
+	} {
+		if opt.enabled {
+			opts = append(opts, opt.option())
+		}
+	}
+	opts = append(opts, compareRuleOptions(d.CompareRules)...)
+	opts = append(opts, transformRuleOptions(d.TransformRules)...)
+	return append(opts, d.Options...)
 }
 
-func getPlistFiles(fSys fs.FS) (map[string]struct{}, error) {
+func (d *differ) getPlistFiles(fSys fs.FS) (map[string]struct{}, error) {
 	files := map[string]struct{}{}
-	err := fs.WalkDir(fSys, ".", func(path string, d fs.DirEntry, err error) error {
+	err := d.walkPlistFiles(fSys, func(path string) error {
+		files[path] = struct{}{}
+		return nil
+	})
+	return files, err
+}
+
+// walkPlistFiles calls fn with the path of each plist file in fSys in the order fs.WalkDir visits
+// them.
+func (d *differ) walkPlistFiles(fSys fs.FS, fn func(path string) error) error {
+	return fs.WalkDir(fSys, ".", func(path string, dir fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrPermission) && d.IgnorePermissionError && path != "." {
+			d.Log.warnOncef("permission:"+path, "skipping %s: %v", path, err)
+			if dir != nil && dir.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		if !d.Type().IsRegular() {
+		if !dir.Type().IsRegular() {
 			return nil
 		}
-		if !strings.HasSuffix(path, ".plist") {
+		ok, err := d.includeFile(path, dir)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			return nil
 		}
-		files[path] = struct{}{}
-		return nil
+		return fn(path)
 	})
-	return files, err
 }
 
-type stringDiff string
-
-func (s stringDiff) String() string {
-	return string(s)
+// WalkPlists calls fn with the path and decoded value of each plist in fsys that would be compared.
+// Files are filtered the same way as for comparisons, including WhereKey, and files that can't be
+// decoded are skipped with a warning. An error from fn stops the walk and is returned.
+func (d *differ) WalkPlists(fsys fs.FS, fn func(path string, decoded interface{}) error) error {
+	return d.walkPlistFiles(fsys, func(path string) error {
+		data, err := d.readFile(fsys, path)
+		if err != nil || data == nil {
+			return err
+		}
+		val, _, err := decodePlist(data, decodeOptions{format: d.AssumeFormat, maxDepth: d.MaxNesting})
+		if err != nil {
+			d.Log.warnf("%s could not be parsed as a plist", path)
+			return nil
+		}
+		return fn(path, val)
+	})
 }
 
 // FileDiff is one difference between two plists
 type FileDiff struct {
 	path string
-	old  interface{}
-	new  interface{}
+	// keys are the dict keys and array indexes in path. It is nil for pseudo-diffs like mtime.
+	keys  []interface{}
+	old   interface{}
+	new   interface{}
+	equal bool
+	// oldLine and newLine are source line numbers. 0 means they weren't looked up.
+	oldLine int
+	newLine int
+	// note is extra information about the change like versionUpgraded
+	note string
+	// contextBefore and contextAfter are unchanged sibling entries to show around the change
+	contextBefore []FileDiff
+	contextAfter  []FileDiff
 }
 
 // Path is the cmp.Path pointing to this diff
@@ -228,47 +1496,383 @@ func (d *FileDiff) New() interface{} {
 	return d.new
 }
 
+// Equal is true when this is an equal value rather than a difference
+func (d *FileDiff) Equal() bool {
+	return d.equal
+}
+
 func (d *FileDiff) String() string {
-	var s string
-	if d.old != nil {
-		s += fmt.Sprintf("\t-%s: %+v (%T)\n", d.path, d.old, d.old)
+	return (&formatter{}).diffText(d)
+}
+
+func lineSuffix(line int) string {
+	switch line {
+	case 0:
+		return ""
+	case lineUnavailable:
+		return " [line unavailable]"
+	default:
+		return fmt.Sprintf(" [line %d]", line)
 	}
-	if d.new != nil {
-		s += fmt.Sprintf("\t+%s: %+v (%T)\n", d.path, d.new, d.new)
+}
+
+// formatValue renders v like %+v with dict keys sorted so that composite values always render the same
+// way, and with UIDs marked as such at any depth. An empty dict is rendered as <empty dict> to tell an
+// empty plist apart from a missing or unparseable one.
+func formatValue(v interface{}) string {
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+		return "<empty dict>"
 	}
-	return s
+	return formatNested(v, &cycleGuard{})
+}
+
+func formatNested(v interface{}, guard *cycleGuard) string {
+	marker, ok := guard.enter(v)
+	if !ok {
+		return marker
+	}
+	defer guard.leave(v)
+	switch v := v.(type) {
+	case plistState:
+		return string(v)
+	case plist.UID:
+		return fmt.Sprintf("UID(%d)", uint64(v))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, key := range keys {
+			guard.push(key)
+			entries[i] = key + ":" + formatNested(v[key], guard)
+			guard.pop()
+		}
+		return "map[" + strings.Join(entries, " ") + "]"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i := range v {
+			guard.push(i)
+			items[i] = formatNested(v[i], guard)
+			guard.pop()
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
+
+// ignoreKeys returns a cmp.Option that ignores dict entries with any of the given keys at any depth.
+func ignoreKeys(keys []string) cmp.Option {
+	ignored := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		ignored[key] = true
+	}
+	return cmp.FilterPath(func(p cmp.Path) bool {
+		step, ok := p.Last().(cmp.MapIndex)
+		if !ok {
+			return false
+		}
+		key := step.Key()
+		return key.Kind() == reflect.String && ignored[key.String()]
+	}, cmp.Ignore())
+}
+
+// coerceSingletons compares a scalar and a single-element array containing that scalar as equal.
+func coerceSingletons() cmp.Option {
+	return cmp.FilterValues(func(x, y interface{}) bool {
+		_, ok := singleton(x, y)
+		return ok
+	}, cmp.Comparer(func(x, y interface{}) bool {
+		pair, _ := singleton(x, y)
+		return cmp.Equal(pair[0], pair[1])
+	}))
+}
+
+// nestedDataTransform is the name of the transformer from decodeNestedData
+const nestedDataTransform = "dataPlist"
+
+// decodeNestedData decodes data values that are plists so they are compared as structured values.
+// Data that isn't a plist is compared as bytes.
+func decodeNestedData() cmp.Option {
+	// any text decodes as an OpenStep string, so only dicts and arrays count as plists
+	decode := func(data []byte) (interface{}, bool) {
+		val, _, err := decodePlist(data, decodeOptions{strict: true, maxDepth: defaultMaxNesting})
+		return val, err == nil && isComposite(val)
+	}
+	return cmp.FilterValues(func(x, y []byte) bool {
+		_, xok := decode(x)
+		_, yok := decode(y)
+		return xok || yok
+	}, cmp.Transformer(nestedDataTransform, func(data []byte) interface{} {
+		val, ok := decode(data)
+		if !ok {
+			return data
+		}
+		return val
+	}))
+}
+
+// numericThreshold compares numbers that are within threshold of each other as equal. When patterns
+// isn't empty, only values at key paths matching a pattern are compared this way. Paths that rules
+// apply to are left to the rules.
+func numericThreshold(threshold float64, patterns []string, rules []compareRule) cmp.Option {
+	return cmp.FilterPath(func(p cmp.Path) bool {
+		if firstRule(rules, p) >= 0 {
+			return false
+		}
+		return len(patterns) == 0 || matchKeyPath(patterns, pathKeys(p))
+	}, cmp.FilterValues(func(x, y interface{}) bool {
+		_, xok := toFloat(x)
+		_, yok := toFloat(y)
+		return xok && yok
+	}, cmp.Comparer(func(x, y interface{}) bool {
+		xf, _ := toFloat(x)
+		yf, _ := toFloat(y)
+		return math.Abs(xf-yf) <= threshold
+	})))
+}
+
+// uuidPattern matches UUIDs and GUIDs in any case, optionally in braces
+var uuidPattern = regexp.MustCompile(`^\{?[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\}?$`)
+
+// ignoreUUIDs compares strings that both look like UUIDs as equal. A UUID and a string that isn't
+// one are still different. When patterns isn't empty, only values at key paths matching a pattern
+// are compared this way. Paths that compare rules apply to are left to the rules, and values that
+// transform rules apply to are compared after they are transformed.
+func ignoreUUIDs(patterns []string, rules []compareRule, transforms []transformRule) cmp.Option {
+	return cmp.FilterPath(func(p cmp.Path) bool {
+		if firstRule(rules, p) >= 0 {
+			return false
+		}
+		keys := pathKeys(p)
+		if _, ok := p.Last().(cmp.Transform); !ok {
+			for i := range transforms {
+				if matchKeyPathOrParent([]string{transforms[i].pattern}, keys) {
+					return false
+				}
+			}
+		}
+		return len(patterns) == 0 || matchKeyPath(patterns, keys)
+	}, cmp.FilterValues(func(x, y string) bool {
+		return uuidPattern.MatchString(x) && uuidPattern.MatchString(y)
+	}, cmp.Comparer(func(x, y string) bool {
+		return true
+	})))
+}
+
+// skipLargeData ignores data values when either side is more than limit bytes
+func skipLargeData(limit int) cmp.Option {
+	return cmp.FilterValues(func(x, y []byte) bool {
+		return len(x) > limit || len(y) > limit
+	}, cmp.Ignore())
+}
+
+// matchKeyPath is true when keys joined with / match any of patterns
+func matchKeyPath(patterns []string, keys []interface{}) bool {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprint(key)
+	}
+	keyPath := strings.Join(parts, "/")
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, keyPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat converts plist integers and reals to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// singleton returns the scalar and the element of the single-element array when one of x and y is a
+// scalar and the other is a single-element array containing a scalar.
+func singleton(x, y interface{}) ([2]interface{}, bool) {
+	if arr, ok := y.([]interface{}); ok && len(arr) == 1 && x != nil && !isComposite(x) && !isComposite(arr[0]) {
+		return [2]interface{}{x, arr[0]}, true
+	}
+	if arr, ok := x.([]interface{}); ok && len(arr) == 1 && y != nil && !isComposite(y) && !isComposite(arr[0]) {
+		return [2]interface{}{arr[0], y}, true
+	}
+	return [2]interface{}{}, false
 }
 
-func decodePlist(data []byte) (interface{}, error) {
+// decodeOptions configures decodePlist. The zero value detects the format and is lenient.
+type decodeOptions struct {
+	// format is the plist format data must be in. plist.AutomaticFormat accepts any format.
+	format int
+	// strict disables skipping of anything preceding the content of format
+	strict bool
+	// maxDepth is how deeply dicts and arrays may be nested. 0 means no limit.
+	maxDepth int
+}
+
+// defaultMaxNesting is the default for --max-nesting and the limit for plists that don't come from
+// the trees being compared.
+const defaultMaxNesting = 256
+
+// nestingError is returned by decodePlist for values nested deeper than decodeOptions.maxDepth
+type nestingError struct {
+	maxDepth int
+}
+
+func (e *nestingError) Error() string {
+	return fmt.Sprintf("dicts and arrays are nested more than %d levels deep", e.maxDepth)
+}
+
+// exceedsDepth is true when v has dicts or arrays nested more than max levels deep. It stops
+// descending at max so it can't recurse without bound.
+func exceedsDepth(v interface{}, max int) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if max == 0 {
+			return true
+		}
+		for _, val := range v {
+			if exceedsDepth(val, max-1) {
+				return true
+			}
+		}
+	case []interface{}:
+		if max == 0 {
+			return true
+		}
+		for _, val := range v {
+			if exceedsDepth(val, max-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodePlist decodes data and returns the value along with the format it was decoded as. It is an
+// error for the data to be in any format other than opts.format.
+func decodePlist(data []byte, opts decodeOptions) (interface{}, int, error) {
+	if !opts.strict {
+		data = trimToFormat(data, opts.format)
+	}
 	decoder := plist.NewDecoder(bytes.NewReader(data))
 	var got interface{}
 	err := decoder.Decode(&got)
 	if err != nil {
+		return nil, plist.InvalidFormat, err
+	}
+	if !isFormat(decoder.Format, opts.format) {
+		return nil, decoder.Format, fmt.Errorf("decoded as %s plist instead of %s", plist.FormatNames[decoder.Format], plist.FormatNames[opts.format])
+	}
+	if opts.maxDepth > 0 && exceedsDepth(got, opts.maxDepth) {
+		return nil, decoder.Format, &nestingError{maxDepth: opts.maxDepth}
+	}
+	return got, decoder.Format, nil
+}
+
+// trimToFormat drops anything preceding the start of format's content so that a bad prefix doesn't
+// prevent the decoder from detecting format.
+func trimToFormat(data []byte, format int) []byte {
+	var i int
+	switch format {
+	case plist.XMLFormat:
+		i = bytes.IndexByte(data, '<')
+	case plist.BinaryFormat:
+		i = bytes.Index(data, []byte("bplist"))
+	}
+	if i > 0 {
+		return data[i:]
+	}
+	return data
+}
+
+func isFormat(got, want int) bool {
+	switch want {
+	case plist.AutomaticFormat:
+		return true
+	case plist.OpenStepFormat, plist.GNUStepFormat:
+		// the decoder can't tell these apart unless the GNUStep extensions are used
+		return got == plist.OpenStepFormat || got == plist.GNUStepFormat
+	default:
+		return got == want
+	}
+}
+
+// plistState stands in for the value of a plist that is missing or can't be decoded.
+type plistState string
+
+const (
+	plistMissing     plistState = "<missing>"
+	plistUnparseable plistState = "<unparseable>"
+)
+
+// decodeValue decodes data with do. Nil data is plistMissing, and data that can't be decoded is
+// plistUnparseable. Values that are nested too deeply are an error rather than unparseable because
+// they may be valid plists.
+func decodeValue(data []byte, do decodeOptions) (interface{}, error) {
+	if data == nil {
+		return plistMissing, nil
+	}
+	val, _, err := decodePlist(data, do)
+	var nestErr *nestingError
+	if errors.As(err, &nestErr) {
 		return nil, err
 	}
-	return got, nil
+	if err != nil {
+		return plistUnparseable, nil
+	}
+	return val, nil
 }
 
-func diffPlists(oldData, newData []byte, opts ...cmp.Option) (eq bool, delta string, err error) {
-	oldList, err := decodePlist(oldData)
+// diffPlists compares two encoded plists decoded with do. Nil data is a missing plist.
+func diffPlists(oldData, newData []byte, do decodeOptions, ro reportOptions, opts ...cmp.Option) (eq bool, delta plistDiff, err error) {
+	oldList, err := decodeValue(oldData, do)
 	if err != nil {
-		oldList = nil
+		return false, nil, err
 	}
-	newList, err := decodePlist(newData)
+	newList, err := decodeValue(newData, do)
 	if err != nil {
-		newList = nil
+		return false, nil, err
 	}
-	var r diffReporter
-	eq = cmp.Equal(oldList, newList, append(opts, cmp.Reporter(&r))...)
-	if eq {
-		return true, "", nil
+	if ro.compareRaw && oldList == plistUnparseable && newList == plistUnparseable && !bytes.Equal(oldData, newData) {
+		return false, plistDiff{{
+			path: "root",
+			keys: []interface{}{},
+			old:  plistUnparseable,
+			new:  plistUnparseable,
+			note: "bytes differ",
+		}}, nil
+	}
+	r := diffReporter{
+		reportOptions: ro,
 	}
-	return false, r.String(), nil
+	eq = cmp.Equal(oldList, newList, append(opts, cmp.Reporter(&r))...)
+	return eq, r.diffs, nil
+}
+
+type reportOptions struct {
+	// compareRaw reports plists that both fail to decode as different when their bytes differ
+	compareRaw bool
+	// showEqual includes equal values in the report
+	showEqual bool
+	// context is the number of unchanged sibling dict entries to include on each side of a change
+	context int
 }
 
 type diffReporter struct {
+	reportOptions
 	path  cmp.Path
-	diffs []FileDiff
+	diffs plistDiff
 }
 
 func (r *diffReporter) PushStep(ps cmp.PathStep) {
@@ -280,11 +1884,13 @@ func (r *diffReporter) PopStep() {
 }
 
 func (r *diffReporter) Report(rs cmp.Result) {
-	if rs.Equal() {
+	if rs.ByIgnore() || rs.Equal() && !r.showEqual {
 		return
 	}
 	diff := FileDiff{
-		path: simplePathString(r.path),
+		path:  simplePathString(r.path),
+		keys:  pathKeys(r.path),
+		equal: rs.Equal(),
 	}
 	vx, vy := r.path.Last().Values()
 	if vx.Kind() != reflect.Invalid {
@@ -293,61 +1899,179 @@ func (r *diffReporter) Report(rs cmp.Result) {
 	if vy.Kind() != reflect.Invalid {
 		diff.new = vy.Interface()
 	}
+	if !diff.equal && r.context > 0 {
+		diff.contextBefore, diff.contextAfter = r.siblings()
+	}
 
 	r.diffs = append(r.diffs, diff)
 }
 
-func (r *diffReporter) String() string {
-	result := ""
-	for _, diff := range r.diffs {
-		result += diff.String() + "\n"
+// siblings returns up to r.context unchanged entries on each side of the current path's entry in its
+// parent dict. Changes that aren't in a dict have no siblings.
+func (r *diffReporter) siblings() (before, after []FileDiff) {
+	i, step, ok := dictEntryStep(r.path)
+	if !ok {
+		return nil, nil
+	}
+	px, py := r.path[i-1].Values()
+	if px.Kind() != reflect.Map || py.Kind() != reflect.Map {
+		return nil, nil
+	}
+	keys := sortedStringKeys(px)
+	current := step.Key().String()
+	pos := sort.SearchStrings(keys, current)
+	parentPath := simplePathString(r.path[:i])
+	parentKeys := pathKeys(r.path[:i])
+	sibling := func(key string) (FileDiff, bool) {
+		kv := reflect.ValueOf(key)
+		vx, vy := px.MapIndex(kv), py.MapIndex(kv)
+		if !vx.IsValid() || !vy.IsValid() || !cmp.Equal(vx.Interface(), vy.Interface()) {
+			return FileDiff{}, false
+		}
+		return FileDiff{
+			path:  fmt.Sprintf("%s[%q]", parentPath, key),
+			keys:  append(parentKeys[:len(parentKeys):len(parentKeys)], key),
+			new:   vy.Interface(),
+			equal: true,
+		}, true
+	}
+	for j := pos - 1; j >= 0 && len(before) < r.context; j-- {
+		if sd, ok := sibling(keys[j]); ok {
+			before = append([]FileDiff{sd}, before...)
+		}
+	}
+	for j := pos; j < len(keys) && len(after) < r.context; j++ {
+		if keys[j] == current {
+			continue
+		}
+		if sd, ok := sibling(keys[j]); ok {
+			after = append(after, sd)
+		}
+	}
+	return before, after
+}
+
+// dictEntryStep returns the MapIndex step for the last value in pa, skipping past type assertions,
+// and its index. ok is false when the value isn't a dict entry.
+func dictEntryStep(pa cmp.Path) (i int, step cmp.MapIndex, ok bool) {
+	i = len(pa) - 1
+	for i > 0 {
+		if _, ok = pa[i].(cmp.TypeAssertion); !ok {
+			break
+		}
+		i--
+	}
+	step, ok = pa[i].(cmp.MapIndex)
+	return i, step, ok && i > 0
+}
+
+// sortedStringKeys returns the string keys of the map m in order
+func sortedStringKeys(m reflect.Value) []string {
+	var keys []string
+	for _, k := range m.MapKeys() {
+		if k.Kind() == reflect.String {
+			keys = append(keys, k.String())
+		}
 	}
-	return strings.TrimRight(result, "\n")
+	sort.Strings(keys)
+	return keys
 }
 
 func simplePathString(pa cmp.Path) string {
-	var ssPre, ssPost []string
-	var numIndirect int
+	var w pathWriter
+	w.post.Grow(len(pa) * 8)
 	for i, s := range pa {
+		if i == 0 {
+			// cmp names the root after its type unless the type has braces
+			w.post.WriteString("root")
+			continue
+		}
 		var nextStep cmp.PathStep
 		if i+1 < len(pa) {
 			nextStep = pa[i+1]
 		}
-		switch s := s.(type) {
-		case cmp.Indirect:
-			numIndirect++
-			pPre, pPost := "(", ")"
-			switch nextStep.(type) {
-			case cmp.Indirect:
-				continue // Next step is indirection, so let them batch up
-			case cmp.StructField:
-				numIndirect-- // Automatic indirection on struct fields
-			case nil:
-				pPre, pPost = "", "" // Last step; no need for parenthesis
-			}
-			if numIndirect > 0 {
-				ssPre = append(ssPre, pPre+strings.Repeat("*", numIndirect))
-				ssPost = append(ssPost, pPost)
-			}
-			numIndirect = 0
-			continue
-		case cmp.Transform:
-			ssPre = append(ssPre, s.Name()+"(")
-			ssPost = append(ssPost, ")")
-			continue
-		case cmp.TypeAssertion:
-			continue
+		w.step(s, nextStep)
+	}
+	return w.String()
+}
+
+// pathWriter builds the string for simplePathString one step at a time
+type pathWriter struct {
+	// prefixes are rare, so only post gets preallocated
+	pre         []string
+	post        strings.Builder
+	numIndirect int
+}
+
+func (w *pathWriter) step(s, nextStep cmp.PathStep) {
+	switch s := s.(type) {
+	case cmp.Indirect:
+		w.indirect(nextStep)
+	case cmp.Transform:
+		w.transform(s.Name())
+	case cmp.TypeAssertion:
+	case cmp.MapIndex:
+		// same as s.String() for string keys without going through fmt
+		if key := s.Key(); key.Kind() == reflect.String {
+			w.post.WriteString("[" + strconv.Quote(key.String()) + "]")
+			return
+		}
+		w.post.WriteString(s.String())
+	case cmp.SliceIndex:
+		if ix, iy := s.SplitKeys(); ix == iy {
+			w.post.WriteString("[" + strconv.Itoa(ix) + "]")
+			return
 		}
-		ssPost = append(ssPost, s.String())
+		w.post.WriteString(s.String())
+	default:
+		w.post.WriteString(s.String())
+	}
+}
+
+func (w *pathWriter) indirect(nextStep cmp.PathStep) {
+	w.numIndirect++
+	pPre, pPost := "(", ")"
+	switch nextStep.(type) {
+	case cmp.Indirect:
+		return // Next step is indirection, so let them batch up
+	case cmp.StructField:
+		w.numIndirect-- // Automatic indirection on struct fields
+	case nil:
+		pPre, pPost = "", "" // Last step; no need for parenthesis
+	}
+	if w.numIndirect > 0 {
+		w.pre = append(w.pre, pPre+strings.Repeat("*", w.numIndirect))
+		w.post.WriteString(pPost)
 	}
-	for i, j := 0, len(ssPre)-1; i < j; i, j = i+1, j-1 {
-		ssPre[i], ssPre[j] = ssPre[j], ssPre[i]
+	w.numIndirect = 0
+}
+
+func (w *pathWriter) transform(name string) {
+	switch name {
+	case nestedDataTransform:
+		w.post.WriteString("<data-plist>")
+	case normalizeObjectsTransform, transformValueTransform:
+		// the keys are the same after these, so there's nothing to show
+	default:
+		w.pre = append(w.pre, name+"(")
+		w.post.WriteString(")")
+	}
+}
+
+func (w *pathWriter) String() string {
+	if len(w.pre) == 0 {
+		return w.post.String()
+	}
+	var b strings.Builder
+	for i := len(w.pre) - 1; i >= 0; i-- {
+		b.WriteString(w.pre[i])
 	}
-	return strings.Join(ssPre, "") + strings.Join(ssPost, "")
+	b.WriteString(w.post.String())
+	return b.String()
 }
 
-func (d *differ) plSnapshot(src fs.FS) (*memfs.FS, error) {
-	dest := memfs.New()
+func (d *differ) plSnapshot(src fs.FS) (*memFS, error) {
+	dest := newMemFS()
 	err := fs.WalkDir(src, ".", func(path string, dir fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -355,10 +2079,14 @@ func (d *differ) plSnapshot(src fs.FS) (*memfs.FS, error) {
 		if dir.IsDir() {
 			return dest.MkdirAll(path, dir.Type())
 		}
-		if !strings.HasSuffix(path, ".plist") {
+		if !dir.Type().IsRegular() {
 			return nil
 		}
-		if !dir.Type().IsRegular() {
+		ok, err := d.includeFile(path, dir)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			return nil
 		}
 
@@ -366,7 +2094,15 @@ func (d *differ) plSnapshot(src fs.FS) (*memfs.FS, error) {
 		if err != nil {
 			return err
 		}
-		err = dest.WriteFile(path, content, dir.Type())
+		if content == nil {
+			// skipped because of a permission error or WhereKey
+			return nil
+		}
+		info, err := dir.Info()
+		if err != nil {
+			return err
+		}
+		err = dest.writeFile(path, content, info)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,2829 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// benchmarkSizes are the numbers of files in the synthetic trees for benchmarks
+var benchmarkSizes = []int{10, 100, 1000}
+
+// syntheticPlist is an XML plist with keys string entries, a nested dict and an array. Plists
+// with different seeds have different values for every tenth key.
+func syntheticPlist(keys, seed int) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<plist version="1.0">` + "\n<dict>\n")
+	for i := 0; i < keys; i++ {
+		val := i
+		if i%10 == 0 {
+			val += seed
+		}
+		fmt.Fprintf(&b, "\t<key>key%d</key>\n\t<string>value %d</string>\n", i, val)
+	}
+	fmt.Fprintf(&b, "\t<key>nested</key>\n\t<dict>\n\t\t<key>count</key>\n\t\t<integer>%d</integer>\n\t</dict>\n", seed)
+	fmt.Fprintf(&b, "\t<key>list</key>\n\t<array>\n\t\t<string>a</string>\n\t\t<integer>%d</integer>\n\t</array>\n", seed)
+	b.WriteString("</dict>\n</plist>\n")
+	return []byte(b.String())
+}
+
+// syntheticTree is a tree of files plists with 50 keys each spread over 10 directories
+func syntheticTree(files, seed int) fstest.MapFS {
+	tree := fstest.MapFS{}
+	for i := 0; i < files; i++ {
+		tree[fmt.Sprintf("dir%d/file%d.plist", i%10, i)] = &fstest.MapFile{Data: syntheticPlist(50, seed)}
+	}
+	return tree
+}
+
+func BenchmarkDiffFS(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		a, c := syntheticTree(size, 0), syntheticTree(size, 1)
+		b.Run(fmt.Sprintf("files=%d", size), func(b *testing.B) {
+			d := &differ{}
+			for i := 0; i < b.N; i++ {
+				_, _, err := d.diffFS(a, c)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDiffFSMostlyUnchanged diffs trees where one file in a hundred changed. The unchanged files
+// have identical bytes, or for reformatted the same values written with different whitespace so
+// that they have to be decoded and compared.
+func BenchmarkDiffFSMostlyUnchanged(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		for _, reformatted := range []bool{false, true} {
+			a, c := syntheticTree(size, 0), syntheticTree(size, 0)
+			i := 0
+			for _, file := range c {
+				switch {
+				case i%100 == 0:
+					file.Data = syntheticPlist(50, 1)
+				case reformatted:
+					file.Data = []byte(strings.ReplaceAll(string(file.Data), "\t", "  "))
+				}
+				i++
+			}
+			b.Run(fmt.Sprintf("files=%d/reformatted=%t", size, reformatted), func(b *testing.B) {
+				d := &differ{}
+				for i := 0; i < b.N; i++ {
+					_, _, err := d.diffFS(a, c)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDiffPlists(b *testing.B) {
+	for _, keys := range []int{10, 100, 1000} {
+		a, c := syntheticPlist(keys, 0), syntheticPlist(keys, 1)
+		b.Run(fmt.Sprintf("keys=%d", keys), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _, err := diffPlists(a, c, decodeOptions{maxDepth: defaultMaxNesting}, reportOptions{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPlSnapshot(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		tree := syntheticTree(size, 0)
+		b.Run(fmt.Sprintf("files=%d", size), func(b *testing.B) {
+			d := &differ{}
+			for i := 0; i < b.N; i++ {
+				_, err := d.plSnapshot(tree)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// deniedFS is an fs.FS where opening the files in denied fails with fs.ErrPermission
+type deniedFS struct {
+	fs.FS
+	denied map[string]bool
+}
+
+func (d deniedFS) Open(name string) (fs.File, error) {
+	if d.denied[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return d.FS.Open(name)
+}
+
+func TestSnapshotUnreadableFile(t *testing.T) {
+	tree := deniedFS{
+		FS: fstest.MapFS{
+			"prefs.plist":  {Data: []byte(`<plist version="1.0"><dict><key>a</key><true/></dict></plist>`)},
+			"secret.plist": {Data: []byte(`<plist version="1.0"><dict><key>b</key><true/></dict></plist>`)},
+		},
+		denied: map[string]bool{"secret.plist": true},
+	}
+	d := &differ{IgnorePermissionError: true}
+	snap, err := d.plSnapshot(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fs.Stat(snap, "secret.plist"); err == nil {
+		t.Error("unreadable file is in the snapshot")
+	}
+	// the first watch tick compares the snapshot to the tree
+	eq, diff, err := d.diffFS(snap, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eq || len(diff) != 0 {
+		t.Errorf("expected no changes, got:\n%s", diff)
+	}
+}
+
+// TestLogLevelPermissionWarning checks the permission warning at each --log-level. TestFlags can't
+// because tests may run as root, which can read anything.
+func TestLogLevelPermissionWarning(t *testing.T) {
+	for _, td := range []struct {
+		level string
+		want  string
+	}{
+		{level: "warn", want: "warning: skipping secret.plist: open secret.plist: permission denied\n"},
+		{level: "error", want: ""},
+	} {
+		td := td
+		t.Run(td.level, func(t *testing.T) {
+			files := fstest.MapFS{
+				"secret.plist": {Data: []byte(`<plist version="1.0"><dict><key>b</key><true/></dict></plist>`)},
+			}
+			tree := deniedFS{FS: files, denied: map[string]bool{"secret.plist": true}}
+			var stderr bytes.Buffer
+			o := &compareOptions{LogLevel: td.level}
+			d, err := o.differ(&stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = d.diffFS(files, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(td.want, stderr.String()); diff != "" {
+				t.Errorf("stderr (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// pathVisitor is a cmp.Reporter that calls visit with the path of every reported value. cmp reuses
+// map and slice steps, so paths are only valid until visit returns.
+type pathVisitor struct {
+	path  cmp.Path
+	visit func(cmp.Path)
+}
+
+func (v *pathVisitor) PushStep(ps cmp.PathStep) {
+	v.path = append(v.path, ps)
+}
+
+func (v *pathVisitor) PopStep() {
+	v.path = v.path[:len(v.path)-1]
+}
+
+func (v *pathVisitor) Report(cmp.Result) {
+	v.visit(v.path)
+}
+
+// visitPaths decodes the XML plists a and b and compares them with a pathVisitor
+func visitPaths(t testing.TB, a, b string, visit func(cmp.Path), opts ...cmp.Option) {
+	t.Helper()
+	do := decodeOptions{maxDepth: defaultMaxNesting}
+	x, err := decodeValue([]byte(xmlPlist(a)), do)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := decodeValue([]byte(xmlPlist(b)), do)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp.Equal(x, y, append(opts, cmp.Reporter(&pathVisitor{visit: visit}))...)
+}
+
+func xmlPlist(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<plist version="1.0">` + body + "</plist>\n"
+}
+
+// nestedPlist is body wrapped in depth dicts that alternate with single element arrays
+func nestedPlist(depth int, body string) string {
+	for i := 0; i < depth; i++ {
+		if i%2 == 0 {
+			body = fmt.Sprintf("<dict><key>level \"%d\"</key>%s</dict>", i, body)
+		} else {
+			body = "<array>" + body + "</array>"
+		}
+	}
+	return body
+}
+
+// simplePathStringCases are plists that produce every kind of step simplePathString handles
+var simplePathStringCases = []struct {
+	name string
+	a, b string
+	opts []cmp.Option
+}{
+	{
+		name: "scalar",
+		a:    `<string>a</string>`,
+		b:    `<string>b</string>`,
+	},
+	{
+		name: "nested",
+		a:    nestedPlist(12, `<string>a</string>`),
+		b:    nestedPlist(12, `<string>b</string>`),
+	},
+	{
+		name: "quoted keys",
+		a:    `<dict><key>with "quotes"</key><true/><key>tab\there</key><true/><key>ünïcode</key><true/></dict>`,
+		b:    `<dict><key>with "quotes"</key><false/><key>tab\there</key><false/><key>ünïcode</key><false/></dict>`,
+	},
+	{
+		name: "array insert",
+		a:    `<array><string>a</string><string>c</string></array>`,
+		b:    `<array><string>a</string><string>b</string><string>c</string></array>`,
+	},
+	{
+		name: "array remove",
+		a:    `<array><string>a</string><string>b</string><string>c</string></array>`,
+		b:    `<array><string>c</string></array>`,
+	},
+	{
+		name: "mixed types",
+		a:    `<dict><key>a</key><integer>1</integer><key>b</key><array><real>1.5</real></array></dict>`,
+		b:    `<dict><key>a</key><string>1</string><key>b</key><array><date>2020-01-01T00:00:00Z</date></array></dict>`,
+	},
+	{
+		name: "nested data",
+		a:    `<dict><key>blob</key><data>` + nestedDataFixture(`<dict><key>x</key><integer>1</integer></dict>`) + `</data></dict>`,
+		b:    `<dict><key>blob</key><data>` + nestedDataFixture(`<dict><key>x</key><integer>2</integer></dict>`) + `</data></dict>`,
+		opts: []cmp.Option{decodeNestedData()},
+	},
+	{
+		name: "keyed archive",
+		a: `<dict><key>$archiver</key><string>NSKeyedArchiver</string><key>$top</key><dict><key>root</key><integer>1</integer></dict>` +
+			`<key>$objects</key><array><string>$null</string><string>a</string></array></dict>`,
+		b: `<dict><key>$archiver</key><string>NSKeyedArchiver</string><key>$top</key><dict><key>root</key><integer>1</integer></dict>` +
+			`<key>$objects</key><array><string>$null</string><string>b</string></array></dict>`,
+		opts: []cmp.Option{normalizeObjects()},
+	},
+	{
+		name: "transform rule",
+		a:    `<dict><key>name</key><string>Alice</string></dict>`,
+		b:    `<dict><key>name</key><string>BOB</string></dict>`,
+		opts: transformRuleOptions([]transformRule{{pattern: "name", transform: transformLowercase}}),
+	},
+	{
+		name: "named transformer",
+		a:    `<dict><key>name</key><string> a </string></dict>`,
+		b:    `<dict><key>name</key><string> b </string></dict>`,
+		opts: []cmp.Option{cmp.Transformer("trim", func(s string) trimmed { return trimmed(strings.TrimSpace(s)) })},
+	},
+	{
+		name: "indirect",
+		a:    `<dict><key>name</key><string>a</string></dict>`,
+		b:    `<dict><key>name</key><string>b</string></dict>`,
+		opts: []cmp.Option{cmp.Transformer("ptr", func(s string) **trimmed { t := trimmed(s); p := &t; return &p })},
+	},
+}
+
+// trimmed is a string type for test transformers. Transforming to a different type keeps cmp from
+// applying them again to their own output.
+type trimmed string
+
+func nestedDataFixture(body string) string {
+	var b strings.Builder
+	enc := base64.NewEncoder(base64.StdEncoding, &b)
+	_, _ = enc.Write([]byte(xmlPlist(body)))
+	_ = enc.Close()
+	return b.String()
+}
+
+// TestSimplePathStringGolden checks simplePathString against testdata/simplepathstring.golden and the
+// slice based implementation it replaced. Run with -update to rewrite the golden file.
+func TestSimplePathStringGolden(t *testing.T) {
+	var got strings.Builder
+	for _, tc := range simplePathStringCases {
+		fmt.Fprintf(&got, "# %s\n", tc.name)
+		visitPaths(t, tc.a, tc.b, func(p cmp.Path) {
+			s := simplePathString(p)
+			if want := joinedPathString(p); s != want {
+				t.Errorf("%s: simplePathString() = %q, previous implementation = %q", tc.name, s, want)
+			}
+			got.WriteString(s + "\n")
+		}, tc.opts...)
+	}
+	golden := filepath.Join("testdata", "simplepathstring.golden")
+	if *updateGolden {
+		err := os.WriteFile(golden, []byte(got.String()), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), got.String()); diff != "" {
+		t.Errorf("output differs from %s (-want +got):\n%s", golden, diff)
+	}
+}
+
+func BenchmarkSimplePathString(b *testing.B) {
+	impls := []struct {
+		name string
+		fn   func(cmp.Path) string
+	}{
+		{name: "old", fn: joinedPathString},
+		{name: "new", fn: simplePathString},
+	}
+	// the only reported value is the string at the bottom of the nesting
+	visitPaths(b, nestedPlist(12, `<string>a</string>`), nestedPlist(12, `<string>b</string>`), func(p cmp.Path) {
+		for _, impl := range impls {
+			fn := impl.fn
+			b.Run(impl.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_ = fn(p)
+				}
+			})
+		}
+	})
+}
+
+// joinedPathString is simplePathString as it was before it used a strings.Builder. It's kept as a
+// reference for TestSimplePathStringGolden and BenchmarkSimplePathString.
+func joinedPathString(pa cmp.Path) string {
+	var ssPre, ssPost []string
+	var numIndirect int
+	for i, s := range pa {
+		var nextStep cmp.PathStep
+		if i+1 < len(pa) {
+			nextStep = pa[i+1]
+		}
+		switch s := s.(type) {
+		case cmp.Indirect:
+			numIndirect++
+			pPre, pPost := "(", ")"
+			switch nextStep.(type) {
+			case cmp.Indirect:
+				continue
+			case cmp.StructField:
+				numIndirect--
+			case nil:
+				pPre, pPost = "", ""
+			}
+			if numIndirect > 0 {
+				ssPre = append(ssPre, pPre+strings.Repeat("*", numIndirect))
+				ssPost = append(ssPost, pPost)
+			}
+			numIndirect = 0
+			continue
+		case cmp.Transform:
+			if s.Name() == nestedDataTransform {
+				ssPost = append(ssPost, "<data-plist>")
+				continue
+			}
+			if s.Name() == normalizeObjectsTransform || s.Name() == transformValueTransform {
+				continue
+			}
+			ssPre = append(ssPre, s.Name()+"(")
+			ssPost = append(ssPost, ")")
+			continue
+		case cmp.TypeAssertion:
+			continue
+		}
+		if i == 0 {
+			ssPost = append(ssPost, "root")
+			continue
+		}
+		ssPost = append(ssPost, s.String())
+	}
+	for i, j := 0, len(ssPre)-1; i < j; i, j = i+1, j-1 {
+		ssPre[i], ssPre[j] = ssPre[j], ssPre[i]
+	}
+	return strings.Join(ssPre, "") + strings.Join(ssPost, "")
+}
+
+func TestGlobFS(t *testing.T) {
+	for _, td := range []struct {
+		name    string
+		pattern string
+		// root is the directory the files are named relative to
+		root    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "one directory",
+			pattern: "testdata/glob/prefs/com.example.*",
+			root:    "testdata/glob/prefs",
+			want:    []string{"com.example.a.plist", "com.example.b.plist", "com.example.txt"},
+		},
+		{
+			name:    "several directories",
+			pattern: "testdata/glob/*/com.example.a.plist",
+			root:    "testdata/glob",
+			want:    []string{"other/com.example.a.plist", "prefs/com.example.a.plist"},
+		},
+		{
+			name:    "no matches",
+			pattern: "testdata/glob/prefs/*.nope",
+			wantErr: "no files match testdata/glob/prefs/*.nope",
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			fsys, err := globFS(filepath.FromSlash(td.pattern))
+			if td.wantErr != "" {
+				if err == nil || err.Error() != filepath.FromSlash(td.wantErr) {
+					t.Fatalf("got error %v, want %q", err, td.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err = fs.WalkDir(fsys, ".", func(path string, dir fs.DirEntry, err error) error {
+				if err == nil && dir.Type().IsRegular() {
+					got = append(got, path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(td.want, got); diff != "" {
+				t.Errorf("files (-want +got):\n%s", diff)
+			}
+			for _, name := range got {
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantData, err := os.ReadFile(filepath.Join(filepath.FromSlash(td.root), filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, wantData) {
+					t.Errorf("%s has the wrong content", name)
+				}
+			}
+		})
+	}
+}
+
+// flagdata is the path of a file or tree under testdata/flags
+func flagdata(elem ...string) string {
+	return filepath.Join(append([]string{"testdata", "flags"}, elem...)...)
+}
+
+// absFlagdata is flagdata as an absolute path like kong makes existingfile args
+func absFlagdata(elem ...string) string {
+	filename, err := filepath.Abs(flagdata(elem...))
+	if err != nil {
+		panic(err)
+	}
+	return filename
+}
+
+// TestFlags runs plist-diff with flags on small trees under testdata/flags and checks what it writes
+// to stdout.
+func TestFlags(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		args []string
+		want string
+		// wantErr is part of stderr for commands that should fail
+		wantErr string
+		// wantStderr is compared to stderr when it isn't empty
+		wantStderr string
+		// noStderr checks that nothing is written to stderr
+		noStderr bool
+	}{
+		{
+			name: "sort by name",
+			args: []string{"--name-only", flagdata("sort", "a"), flagdata("sort", "b")},
+			want: "a-two.plist\nm-five.plist\nz-two.plist\n",
+		},
+		{
+			name: "sort by changes",
+			args: []string{"--sort=changes", "--name-only", flagdata("sort", "a"), flagdata("sort", "b")},
+			want: "m-five.plist\na-two.plist\nz-two.plist\n",
+		},
+		{
+			name: "ignore key at any depth",
+			args: []string{"--ignore-key", "LastLaunchTime", flagdata("ignore-key", "a"), flagdata("ignore-key", "b")},
+			want: `prefs.plist:
+	-root["Name"]: name 1 (string)
+	+root["Name"]: name 2 (string)
+
+
+`,
+		},
+		{
+			name: "ignore key that is not there",
+			args: []string{"--ignore-key", "Title", "--name-only", flagdata("ignore-key", "a"), flagdata("ignore-key", "b")},
+			want: "prefs.plist\n",
+		},
+		{
+			name: "without show-equal",
+			args: []string{flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `prefs.plist:
+	+root["Added"]: here (string)
+
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+	-root["Name"]: old (string)
+	+root["Name"]: new (string)
+
+	-root["Removed"]: gone (string)
+
+
+`,
+		},
+		{
+			name: "show-equal",
+			args: []string{"--show-equal", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `prefs.plist:
+	+root["Added"]: here (string)
+
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+	=root["Enabled"]: true (bool)
+
+	-root["Name"]: old (string)
+	+root["Name"]: new (string)
+
+	-root["Removed"]: gone (string)
+
+
+`,
+		},
+		{
+			name: "files-from",
+			args: []string{"--name-only", "--files-from", flagdata("files-from", "list.txt"), flagdata("files-from", "a"), flagdata("files-from", "b")},
+			want: "one.plist\n",
+		},
+		{
+			name:    "files-from missing file",
+			args:    []string{"--name-only", "--files-from", flagdata("files-from", "missing.txt"), flagdata("files-from", "a"), flagdata("files-from", "b")},
+			wantErr: "not found in either tree: missing.plist",
+		},
+		{
+			name: "files-from ignore-missing",
+			args: []string{"--name-only", "--ignore-missing", "--files-from", flagdata("files-from", "missing.txt"), flagdata("files-from", "a"), flagdata("files-from", "b")},
+			want: "one.plist\n",
+		},
+		{
+			name: "columns",
+			args: []string{"--format=columns", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `prefs.plist:
+  root["Added"]
+                                         | here
+  root["Count"]
+    1                                    | 2
+  root["Name"]
+    old                                  | new
+  root["Removed"]
+    gone                                 |
+
+
+`,
+		},
+		{
+			name: "columns composite",
+			args: []string{"--format=columns", flagdata("composite", "a"), flagdata("composite", "b")},
+			want: `prefs.plist:
+  root["Window"]
+                                         | {…}
+
+
+`,
+		},
+		{
+			name: "columns expand",
+			args: []string{"--format=columns", "--expand", flagdata("composite", "a"), flagdata("composite", "b")},
+			want: `prefs.plist:
+  root["Window"]
+                                         | map[Width:10]
+
+
+`,
+		},
+		{
+			name: "assume-format xml without declaration",
+			args: []string{"--assume-format=xml", flagdata("assume-format", "a"), flagdata("assume-format", "b")},
+			want: `prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "assume-format binary skips xml",
+			args: []string{"--assume-format=binary", flagdata("assume-format", "a"), flagdata("assume-format", "b")},
+			want: "",
+		},
+		{
+			name: "source-locations",
+			args: []string{"--source-locations", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `prefs.plist:
+	+root["Added"]: here (string) [line 5]
+
+	-root["Count"]: 1 (uint64) [line 5]
+	+root["Count"]: 2 (uint64) [line 7]
+
+	-root["Name"]: old (string) [line 9]
+	+root["Name"]: new (string) [line 11]
+
+	-root["Removed"]: gone (string) [line 11]
+
+
+`,
+		},
+		{
+			name: "source-locations binary",
+			args: []string{"--source-locations", flagdata("binary", "a"), flagdata("binary", "b")},
+			want: `prefs.plist:
+	+root["Added"]: here (string) [line unavailable]
+
+	-root["Count"]: 1 (uint64) [line unavailable]
+	+root["Count"]: 2 (uint64) [line unavailable]
+
+	-root["Name"]: old (string) [line unavailable]
+	+root["Name"]: new (string) [line unavailable]
+
+	-root["Removed"]: gone (string) [line unavailable]
+
+
+`,
+		},
+		{
+			name: "dedup",
+			args: []string{"--dedup", flagdata("dedup", "a"), flagdata("dedup", "b")},
+			want: `in 3 files: one.plist, three.plist, two.plist:
+	-root["Version"]: 1.0 (string)
+	+root["Version"]: 2.0 (string)
+
+three.plist:
+	-root["Name"]: three (string)
+	+root["Name"]: tres (string)
+
+
+`,
+		},
+		{
+			name: "jsonl",
+			args: []string{"--format=jsonl", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `{"time":"TIME","file":"prefs.plist","diffs":[{"path":"root[\"Added\"]","new":"here"},{"path":"root[\"Count\"]","old":1,"new":2},{"path":"root[\"Name\"]","old":"old","new":"new"},{"path":"root[\"Removed\"]","old":"gone"}]}
+`,
+		},
+		{
+			name: "without intersection",
+			args: []string{"--name-only", flagdata("intersection", "a"), flagdata("intersection", "b")},
+			want: "a-only.plist\nb-only.plist\nboth.plist\n",
+		},
+		{
+			name: "intersection",
+			args: []string{"--name-only", "--intersection", flagdata("intersection", "a"), flagdata("intersection", "b")},
+			want: "both.plist\n",
+		},
+		{
+			name: "intersection streaming",
+			args: []string{"--name-only", "--intersection", "--streaming", flagdata("intersection", "a"), flagdata("intersection", "b")},
+			want: "both.plist\n",
+		},
+		{
+			name: "context",
+			args: []string{"--context", "1", flagdata("context", "a"), flagdata("context", "b")},
+			want: `list.plist:
+	-root["Items"][1]: y (string)
+	+root["Items"][1]: why (string)
+
+prefs.plist:
+	 root["Beta"]: b (string)
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+	 root["Delta"]: d (string)
+
+
+`,
+		},
+		{
+			name: "context past the ends of the dict",
+			args: []string{"--context", "3", flagdata("context", "a"), flagdata("context", "b")},
+			want: `list.plist:
+	-root["Items"][1]: y (string)
+	+root["Items"][1]: why (string)
+
+prefs.plist:
+	 root["Alpha"]: a (string)
+	 root["Beta"]: b (string)
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+	 root["Delta"]: d (string)
+	 root["Echo"]: e (string)
+
+
+`,
+		},
+		{
+			name: "check-encoding",
+			args: []string{"--check-encoding", flagdata("check-encoding", "a"), flagdata("check-encoding", "b")},
+			want: `prefs.plist:
+	-root: <unparseable>
+	+root: map[Name:café] (map[string]interface {})
+
+
+`,
+			wantStderr: `testdata/flags/check-encoding/a: prefs.plist declares UTF-8 encoding but looks like ISO-8859-1
+warning: prefs.plist could not be parsed as a plist
+`,
+		},
+		{
+			name: "without check-encoding",
+			args: []string{flagdata("check-encoding", "a"), flagdata("check-encoding", "b")},
+			want: `prefs.plist:
+	-root: <unparseable>
+	+root: map[Name:café] (map[string]interface {})
+
+
+`,
+			wantStderr: "warning: prefs.plist could not be parsed as a plist\n",
+		},
+		{
+			name: "max-value-length",
+			args: []string{"--max-value-length", "10", flagdata("max-value-length", "a"), flagdata("max-value-length", "b")},
+			want: `prefs.plist:
+	-root["Cert"]: MIIBAAAAAA…(truncated, 30 total) (string)
+	+root["Cert"]: MIIBBBBBBB…(truncated, 30 total) (string)
+
+
+`,
+		},
+		{
+			name: "max-value-length at the length",
+			args: []string{"--max-value-length", "30", flagdata("max-value-length", "a"), flagdata("max-value-length", "b")},
+			want: `prefs.plist:
+	-root["Cert"]: MIIBAAAAAAAAAAAAAAAAAAAAAAAAAA (string)
+	+root["Cert"]: MIIBBBBBBBBBBBBBBBBBBBBBBBBBBB (string)
+
+
+`,
+		},
+		{
+			name: "max-value-length 0",
+			args: []string{"--max-value-length", "0", flagdata("max-value-length", "a"), flagdata("max-value-length", "b")},
+			want: `prefs.plist:
+	-root["Cert"]: MIIBAAAAAAAAAAAAAAAAAAAAAAAAAA (string)
+	+root["Cert"]: MIIBBBBBBBBBBBBBBBBBBBBBBBBBBB (string)
+
+
+`,
+		},
+		{
+			name: "base",
+			args: []string{"--base", flagdata("base", "base"), flagdata("base", "a"), flagdata("base", "b")},
+			want: `prefs.plist:
+	[conflict] root["Color"]
+		base: red (string)
+		a:    blue (string)
+		b:    green (string)
+	[a-only] root["Count"]
+		base: 1 (uint64)
+		a:    2 (uint64)
+	[b-only] root["Size"]
+		base: 10 (uint64)
+		b:    12 (uint64)
+
+`,
+		},
+		{
+			name:    "base without othertree",
+			args:    []string{"--base", flagdata("base", "base"), flagdata("base", "a")},
+			wantErr: "--base requires othertree",
+		},
+		{
+			name:    "base with another format",
+			args:    []string{"--base", flagdata("base", "base"), "--format=jsonl", flagdata("base", "a"), flagdata("base", "b")},
+			wantErr: "--base only supports --format=text",
+		},
+		{
+			name: "schema-diff",
+			args: []string{"--schema-diff", flagdata("schema-diff", "a"), flagdata("schema-diff", "b")},
+			want: `+ other.plist: root["New"] (Dict)
+- other.plist: root["Old"] (Integer)
+~ prefs.plist: root["Count"] (Integer -> String)
++ prefs.plist: root["Feature"] (Bool)
+- prefs.plist: root["Flag"] (Bool)
+`,
+		},
+		{
+			name: "coerce-singletons",
+			args: []string{"--coerce-singletons", flagdata("coerce-singletons", "a"), flagdata("coerce-singletons", "b")},
+			want: `prefs.plist:
+	-root["Pair"]: x (string)
+	+root["Pair"]: [x y] ([]interface {})
+
+
+`,
+		},
+		{
+			name: "without coerce-singletons",
+			args: []string{flagdata("coerce-singletons", "a"), flagdata("coerce-singletons", "b")},
+			want: `prefs.plist:
+	-root["Pair"]: x (string)
+	+root["Pair"]: [x y] ([]interface {})
+
+	-root["Single"]: x (string)
+	+root["Single"]: [x] ([]interface {})
+
+
+`,
+		},
+		{
+			name:       "relative-to",
+			args:       []string{"--name-only", "--relative-to", "Library/Preferences", flagdata("relative-to", "a"), flagdata("relative-to", "b")},
+			want:       "other.plist\nprefs.plist\n",
+			wantStderr: "warning: other.plist is not under Library/Preferences\n",
+		},
+		{
+			name: "relative-to with trailing slash",
+			args: []string{"--name-only", "--relative-to", "Library/Preferences/", flagdata("relative-to", "a"), flagdata("relative-to", "b")},
+			want: "other.plist\nprefs.plist\n",
+		},
+		{
+			name: "without relative-to",
+			args: []string{"--name-only", flagdata("relative-to", "a"), flagdata("relative-to", "b")},
+			want: "Library/Preferences/prefs.plist\nother.plist\n",
+		},
+		{
+			name: "show-size",
+			args: []string{"--show-size", flagdata("show-size", "a"), flagdata("show-size", "b")},
+			want: `changed.plist:
+	-root["Name"]: old (string)
+	+root["Name"]: newer (string)
+
+	-size: 227B
+	+size: 229B
+
+
+`,
+		},
+		{
+			name: "show-size size-only-changes",
+			args: []string{"--show-size", "--size-only-changes", flagdata("show-size", "a"), flagdata("show-size", "b")},
+			want: `changed.plist:
+	-root["Name"]: old (string)
+	+root["Name"]: newer (string)
+
+	-size: 227B
+	+size: 229B
+
+same.plist:
+	-size: 228B
+	+size: 223B
+
+
+`,
+		},
+		{
+			name:    "since a file that is not a snapshot",
+			args:    []string{flagdata("basic", "a"), "--since", flagdata("basic", "a", "prefs.plist")},
+			wantErr: "prefs.plist: not a plist-diff snapshot",
+		},
+		{
+			name:    "since a missing file",
+			args:    []string{flagdata("basic", "a"), "--since", flagdata("basic", "missing")},
+			wantErr: "no such file or directory",
+		},
+		{
+			name:    "since with othertree",
+			args:    []string{flagdata("basic", "a"), flagdata("basic", "b"), "--since", "yesterday"},
+			wantErr: "--since cannot be used with othertree or --watch-once",
+		},
+		{
+			name:    "since with watch-once",
+			args:    []string{flagdata("basic", "a"), "--watch-once", "--since", "yesterday"},
+			wantErr: "--since cannot be used with othertree or --watch-once",
+		},
+		{
+			name: "path-style cmp",
+			args: []string{"--path-style=cmp", flagdata("nested", "a"), flagdata("nested", "b")},
+			want: `prefs.plist:
+	-root["Windows"][0]["Title"]: main (string)
+	+root["Windows"][0]["Title"]: other (string)
+
+
+`,
+		},
+		{
+			name: "path-style plistbuddy",
+			args: []string{"--path-style=plistbuddy", flagdata("nested", "a"), flagdata("nested", "b")},
+			want: `prefs.plist:
+	-:Windows:0:Title: main (string)
+	+:Windows:0:Title: other (string)
+
+
+`,
+		},
+		{
+			name: "path-style jsonpath",
+			args: []string{"--path-style=jsonpath", flagdata("nested", "a"), flagdata("nested", "b")},
+			want: `prefs.plist:
+	-$.Windows[0].Title: main (string)
+	+$.Windows[0].Title: other (string)
+
+
+`,
+		},
+		{
+			name: "numeric-threshold",
+			args: []string{"--numeric-threshold", "0.5", flagdata("numeric-threshold", "a"), flagdata("numeric-threshold", "b")},
+			want: `prefs.plist:
+	-root["Count"]: 3 (uint64)
+	+root["Count"]: 4 (uint64)
+
+	-root["Size"]["Width"]: 100 (uint64)
+	+root["Size"]["Width"]: 101 (uint64)
+
+
+`,
+		},
+		{
+			name: "numeric-threshold equal to the difference",
+			args: []string{"--numeric-threshold", "1", flagdata("numeric-threshold", "a"), flagdata("numeric-threshold", "b")},
+			want: "",
+		},
+		{
+			name: "numeric-threshold-path",
+			args: []string{"--numeric-threshold", "1", "--numeric-threshold-path", "Size/*", flagdata("numeric-threshold", "a"), flagdata("numeric-threshold", "b")},
+			want: `prefs.plist:
+	-root["Count"]: 3 (uint64)
+	+root["Count"]: 4 (uint64)
+
+	-root["Volume"]: 3 (float64)
+	+root["Volume"]: 3.4 (float64)
+
+
+`,
+		},
+		{
+			name: "skip-file",
+			args: []string{"--name-only", "--skip-file", "three.plist", "--skip-file", "one.plist", flagdata("dedup", "a"), flagdata("dedup", "b")},
+			want: "two.plist\n",
+		},
+		{
+			name: "skip-file in a subdirectory",
+			args: []string{"--name-only", "--skip-file", "prefs.plist", flagdata("relative-to", "a"), flagdata("relative-to", "b")},
+			want: "other.plist\n",
+		},
+		{
+			name:       "digest",
+			args:       []string{"--name-only", "--digest", flagdata("basic", "a"), flagdata("basic", "b")},
+			want:       "prefs.plist\n",
+			wantStderr: "a9133f8921d73adb8b86a790691d8d51c120f065fce302366bdc6e876ab646de\n",
+		},
+		{
+			name:       "digest is the same for binary plists",
+			args:       []string{"--name-only", "--digest", flagdata("binary", "a"), flagdata("binary", "b")},
+			want:       "prefs.plist\n",
+			wantStderr: "a9133f8921d73adb8b86a790691d8d51c120f065fce302366bdc6e876ab646de\n",
+		},
+		{
+			name: "digest with output to stderr",
+			args: []string{"--name-only", "--digest", "--output=stderr", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: "a9133f8921d73adb8b86a790691d8d51c120f065fce302366bdc6e876ab646de\n",
+		},
+		{
+			name:       "digest without changes",
+			args:       []string{"--digest", flagdata("basic", "a"), flagdata("basic", "a")},
+			want:       "",
+			wantStderr: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n",
+		},
+		{
+			name: "ignore-empty-changes",
+			args: []string{"--ignore-empty-changes", flagdata("ignore-empty-changes", "a"), flagdata("ignore-empty-changes", "b")},
+			want: `prefs.plist:
+	-root["Filled"]:  (string)
+	+root["Filled"]: x (string)
+
+
+`,
+		},
+		{
+			name: "without ignore-empty-changes",
+			args: []string{flagdata("ignore-empty-changes", "a"), flagdata("ignore-empty-changes", "b")},
+			want: `prefs.plist:
+	-root["Blank"]:  (string)
+	+root["Blank"]: <empty dict> (map[string]interface {})
+
+	-root["Filled"]:  (string)
+	+root["Filled"]: x (string)
+
+	-root["Gone"]:  (string)
+
+	+root["New"]: [] ([]interface {})
+
+
+`,
+		},
+		{
+			name: "config",
+			args: []string{"--config", flagdata("config", "config.plist"), flagdata("dedup", "a"), flagdata("dedup", "b")},
+			want: "three.plist\none.plist\n",
+		},
+		{
+			name: "config overridden by a flag",
+			args: []string{"--config", flagdata("config", "config.plist"), "--sort=name", flagdata("dedup", "a"), flagdata("dedup", "b")},
+			want: "one.plist\nthree.plist\n",
+		},
+		{
+			name: "config array overridden by a flag",
+			args: []string{"--config", flagdata("config", "config.plist"), "--skip-file", "one.plist", flagdata("dedup", "a"), flagdata("dedup", "b")},
+			want: "three.plist\ntwo.plist\n",
+		},
+		{
+			name:    "config with unknown flags",
+			args:    []string{"--config", flagdata("config", "unknown.plist"), flagdata("dedup", "a"), flagdata("dedup", "b")},
+			wantErr: "config: unknown flags: no-such-flag",
+		},
+		{
+			name:    "config that is not a dict",
+			args:    []string{"--config", flagdata("config", "array.plist"), flagdata("dedup", "a"), flagdata("dedup", "b")},
+			wantErr: "config: must be a dict of flag names to values",
+		},
+		{
+			name: "decode-nested-data",
+			args: []string{"--decode-nested-data", flagdata("decode-nested-data", "a"), flagdata("decode-nested-data", "b")},
+			want: `prefs.plist:
+	-root["Archive"]<data-plist>["Inner"]: 1 (uint64)
+	+root["Archive"]<data-plist>["Inner"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "without decode-nested-data",
+			args: []string{flagdata("decode-nested-data", "a"), flagdata("decode-nested-data", "b")},
+			want: `prefs.plist:
+	-root["Archive"][25]: 1 (uint8)
+	+root["Archive"][25]: 2 (uint8)
+
+
+`,
+		},
+		{
+			name: "compare-path",
+			args: []string{
+				"--compare-path", "Color=rounded:3", "--compare-path", "Tags=unordered", "--compare-path", "Junk=ignore",
+				flagdata("compare-path", "a"), flagdata("compare-path", "b"),
+			},
+			want: `prefs.plist:
+	-root["Scale"]: 0.1234 (float64)
+	+root["Scale"]: 0.1231 (float64)
+
+
+`,
+		},
+		{
+			name: "compare-path first match wins",
+			args: []string{"--compare-path", "Color=exact", "--compare-path", "*=rounded:3", flagdata("compare-path", "a"), flagdata("compare-path", "b")},
+			want: `prefs.plist:
+	-root["Color"][0]: 0.1234 (float64)
+	+root["Color"][0]: 0.1231 (float64)
+
+	-root["Junk"]: 1 (uint64)
+	+root["Junk"]: 2 (uint64)
+
+	-root["Tags"][0]: a (string)
+	+root["Tags"][0]: b (string)
+
+	-root["Tags"][1]: b (string)
+	+root["Tags"][1]: a (string)
+
+
+`,
+		},
+		{
+			name:    "compare-path unknown strategy",
+			args:    []string{"--compare-path", "Color=bogus", flagdata("compare-path", "a"), flagdata("compare-path", "b")},
+			wantErr: `invalid compare path "Color=bogus": unknown strategy "bogus"`,
+		},
+		{
+			name: "name-only leaves out files with the same values",
+			args: []string{"--name-only", flagdata("show-size", "a"), flagdata("show-size", "b")},
+			want: "changed.plist\n",
+		},
+		{
+			name: "ignore-rules",
+			args: []string{"--ignore-rules", flagdata("ignore-rules", "rules.plist"), flagdata("ignore-rules", "a"), flagdata("ignore-rules", "b")},
+			want: `com.apple.dock.plist:
+	-root["WindowFrame"]: 0 0 10 10 (string)
+	+root["WindowFrame"]: 5 5 10 10 (string)
+
+
+`,
+		},
+		{
+			name:    "ignore-rules with a rule that is not an array",
+			args:    []string{"--ignore-rules", flagdata("ignore-rules", "bad.plist"), flagdata("ignore-rules", "a"), flagdata("ignore-rules", "b")},
+			wantErr: "*finder.plist must be an array of key path globs",
+		},
+		{
+			name: "require-file present",
+			args: []string{"--name-only", "--require-file", "both.plist", flagdata("intersection", "a"), flagdata("intersection", "b")},
+			want: "a-only.plist\nb-only.plist\nboth.plist\n",
+		},
+		{
+			name:    "require-file missing",
+			args:    []string{"--name-only", "--require-file", "a-only.plist", flagdata("intersection", "a"), flagdata("intersection", "b")},
+			wantErr: "required files missing: a-only.plist",
+		},
+		{
+			name:    "require-files-from",
+			args:    []string{"--require-files-from", flagdata("require-file", "required.txt"), flagdata("intersection", "a"), flagdata("intersection", "b")},
+			wantErr: "required files missing: b-only.plist",
+		},
+		{
+			name: "absent-bool-false",
+			args: []string{"--absent-bool-false", flagdata("absent-bool-false", "a"), flagdata("absent-bool-false", "b")},
+			want: `prefs.plist:
+	+root["Enabled"]: true (bool)
+
+	+root["Zero"]: 0 (uint64)
+
+
+`,
+		},
+		{
+			name: "absent-bool-false removed",
+			args: []string{"--absent-bool-false", flagdata("absent-bool-false", "b"), flagdata("absent-bool-false", "a")},
+			want: `prefs.plist:
+	-root["Enabled"]: true (bool)
+
+	-root["Zero"]: 0 (uint64)
+
+
+`,
+		},
+		{
+			name:    "max-nesting exceeded",
+			args:    []string{"--max-nesting", "2", flagdata("nested", "a"), flagdata("nested", "b")},
+			wantErr: "prefs.plist: dicts and arrays are nested more than 2 levels deep",
+		},
+		{
+			name: "max-nesting at the depth",
+			args: []string{"--name-only", "--max-nesting", "3", flagdata("nested", "a"), flagdata("nested", "b")},
+			want: "prefs.plist\n",
+		},
+		{
+			name: "max-nesting 0",
+			args: []string{"--name-only", "--max-nesting", "0", flagdata("nested", "a"), flagdata("nested", "b")},
+			want: "prefs.plist\n",
+		},
+		{
+			name: "plistbuddy",
+			args: []string{"--format=plistbuddy", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `#!/bin/sh
+set -e
+
+# prefs.plist
+/usr/libexec/PlistBuddy -c 'Delete :Removed' 'prefs.plist'
+/usr/libexec/PlistBuddy -c 'Set :Count 2' 'prefs.plist'
+/usr/libexec/PlistBuddy -c 'Set :Name new' 'prefs.plist'
+/usr/libexec/PlistBuddy -c 'Add :Added string here' 'prefs.plist'
+`,
+		},
+		{
+			name: "plistbuddy added dict",
+			args: []string{"--format=plistbuddy", flagdata("composite", "a"), flagdata("composite", "b")},
+			want: `#!/bin/sh
+set -e
+
+# prefs.plist
+/usr/libexec/PlistBuddy -c 'Add :Window dict' 'prefs.plist'
+/usr/libexec/PlistBuddy -c 'Add :Window:Width integer 10' 'prefs.plist'
+`,
+		},
+		{
+			name:       "output stderr",
+			args:       []string{"--name-only", "--output=stderr", flagdata("basic", "a"), flagdata("basic", "b")},
+			want:       "",
+			wantStderr: "prefs.plist\n",
+		},
+		{
+			name: "output stdout",
+			args: []string{"--name-only", "--output=stdout", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: "prefs.plist\n",
+		},
+		{
+			name: "normalize-objects reordered",
+			args: []string{"--normalize-objects", flagdata("normalize-objects", "a"), flagdata("normalize-objects", "b")},
+			want: "",
+		},
+		{
+			name: "normalize-objects changed",
+			args: []string{"--normalize-objects", flagdata("normalize-objects", "a"), flagdata("normalize-objects", "c")},
+			want: `archive.plist:
+	-root["$objects"][3]: Ann (string)
+	+root["$objects"][3]: Bob (string)
+
+
+`,
+		},
+		{
+			name: "without normalize-objects",
+			args: []string{"--name-only", flagdata("normalize-objects", "a"), flagdata("normalize-objects", "b")},
+			want: "archive.plist\n",
+		},
+		{
+			name: "stats",
+			args: []string{"--stats", flagdata("stats", "a"), flagdata("stats", "b")},
+			want: "array.plist: 1 of 3 keys changed\ndata.plist: 1 of 2 keys changed\nmany.plist: 2 of 10 keys changed\nscalar.plist: 1 of 1 keys changed\n",
+		},
+		{
+			name: "transform-path",
+			args: []string{
+				"--transform-path", "Label=strip:^[0-9T:-]+ ", "--transform-path", "Kind=lowercase",
+				"--transform-path", "App=trim-prefix:com.example.", "--transform-path", "File=trim-suffix:.txt",
+				flagdata("transform-path", "a"), flagdata("transform-path", "b"),
+			},
+			want: `prefs.plist:
+	-root["Note"]: 2024-01-02 first (string)
+	+root["Note"]: 2024-02-03 first (string)
+
+
+`,
+		},
+		{
+			name:    "transform-path unknown transform",
+			args:    []string{"--transform-path", "Label=bogus", flagdata("transform-path", "a"), flagdata("transform-path", "b")},
+			wantErr: `invalid transform path "Label=bogus": unknown transform "bogus"`,
+		},
+		{
+			name: "compact",
+			args: []string{"--format=compact", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: "prefs.plist\troot[\"Added\"]\t\there\n" +
+				"prefs.plist\troot[\"Count\"]\t1\t2\n" +
+				"prefs.plist\troot[\"Name\"]\told\tnew\n" +
+				"prefs.plist\troot[\"Removed\"]\tgone\t\n",
+		},
+		{
+			name: "compact escapes and composite values",
+			args: []string{"--format=compact", flagdata("compact", "a"), flagdata("compact", "b")},
+			want: "prefs.plist\troot[\"Note\"]\tone\\ttwo\tone\\tthree\n" +
+				"prefs.plist\troot[\"Text\"]\tline\tline\\nbreak\n" +
+				"prefs.plist\troot[\"Window\"]\t\t{\"Width\":10}\n",
+		},
+		{
+			name: "add-marker and remove-marker",
+			args: []string{"--add-marker", ">", "--remove-marker", "<", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `prefs.plist:
+	>root["Added"]: here (string)
+
+	<root["Count"]: 1 (uint64)
+	>root["Count"]: 2 (uint64)
+
+	<root["Name"]: old (string)
+	>root["Name"]: new (string)
+
+	<root["Removed"]: gone (string)
+
+
+`,
+		},
+		{
+			name: "markers with show-equal",
+			args: []string{"--add-marker", "NEW: ", "--remove-marker", "OLD: ", "--show-equal", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `prefs.plist:
+	NEW: root["Added"]: here (string)
+
+	OLD: root["Count"]: 1 (uint64)
+	NEW: root["Count"]: 2 (uint64)
+
+	=root["Enabled"]: true (bool)
+
+	OLD: root["Name"]: old (string)
+	NEW: root["Name"]: new (string)
+
+	OLD: root["Removed"]: gone (string)
+
+
+`,
+		},
+		{
+			name: "archive without strip-components",
+			args: []string{"--name-only", flagdata("archive", "backup.tgz"), flagdata("basic", "b")},
+			want: "backup/prefs.plist\nprefs.plist\n",
+		},
+		{
+			name: "tgz strip-components",
+			args: []string{"--strip-components", "1", flagdata("archive", "backup.tgz"), flagdata("basic", "b")},
+			want: `prefs.plist:
+	+root["Added"]: here (string)
+
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+	-root["Name"]: old (string)
+	+root["Name"]: new (string)
+
+	-root["Removed"]: gone (string)
+
+
+`,
+		},
+		{
+			name: "zip strip-components",
+			args: []string{"--name-only", "--strip-components", "1", flagdata("archive", "backup.zip"), flagdata("basic", "b")},
+			want: "prefs.plist\n",
+		},
+		{
+			name: "mobileconfig",
+			args: []string{"--format=mobileconfig", flagdata("basic", "a"), flagdata("basic", "b")},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<!-- prefs.plist: removed root["Removed"] -->
+<plist version="1.0">
+	<dict>
+		<key>PayloadContent</key>
+		<array>
+			<dict>
+				<key>Added</key>
+				<string>here</string>
+				<key>Count</key>
+				<integer>2</integer>
+				<key>Name</key>
+				<string>new</string>
+				<key>PayloadDisplayName</key>
+				<string>prefs</string>
+				<key>PayloadIdentifier</key>
+				<string>com.example.plist-diff.prefs</string>
+				<key>PayloadType</key>
+				<string>prefs</string>
+				<key>PayloadUUID</key>
+				<string>REPLACE-WITH-UUID</string>
+				<key>PayloadVersion</key>
+				<integer>1</integer>
+			</dict>
+		</array>
+		<key>PayloadDisplayName</key>
+		<string>plist-diff changes</string>
+		<key>PayloadIdentifier</key>
+		<string>com.example.plist-diff</string>
+		<key>PayloadType</key>
+		<string>Configuration</string>
+		<key>PayloadUUID</key>
+		<string>REPLACE-WITH-UUID</string>
+		<key>PayloadVersion</key>
+		<integer>1</integer>
+	</dict>
+</plist>
+`,
+		},
+		{
+			name: "where-key",
+			args: []string{"--where-key", "root.Sync.Enabled", flagdata("where-key", "a"), flagdata("where-key", "b")},
+			want: `gains.plist:
+	-root: <missing>
+	+root: map[Count:1 Sync:map[Enabled:true]] (map[string]interface {})
+
+synced.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "without where-key",
+			args: []string{"--name-only", flagdata("where-key", "a"), flagdata("where-key", "b")},
+			want: "gains.plist\nlocal.plist\nsynced.plist\n",
+		},
+		{
+			name: "canonicalize",
+			args: []string{"canonicalize", flagdata("show-size", "a", "same.plist")},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+	<dict>
+		<key>Count</key>
+		<integer>1</integer>
+	</dict>
+</plist>
+`,
+		},
+		{
+			name: "canonicalize other formatting",
+			args: []string{"canonicalize", flagdata("show-size", "b", "same.plist")},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+	<dict>
+		<key>Count</key>
+		<integer>1</integer>
+	</dict>
+</plist>
+`,
+		},
+		{
+			name: "canonical",
+			args: []string{"--canonical", "--show-size", "--size-only-changes", flagdata("show-size", "a"), flagdata("show-size", "b")},
+			want: `changed.plist:
+	-root["Name"]: old (string)
+	+root["Name"]: newer (string)
+
+	-size: 231B
+	+size: 233B
+
+
+`,
+		},
+		{
+			name: "canonical binary source-locations",
+			args: []string{"--canonical", "--source-locations", flagdata("binary", "a"), flagdata("binary", "b")},
+			want: `prefs.plist:
+	+root["Added"]: here (string) [line 5]
+
+	-root["Count"]: 1 (uint64) [line 5]
+	+root["Count"]: 2 (uint64) [line 7]
+
+	-root["Name"]: old (string) [line 9]
+	+root["Name"]: new (string) [line 11]
+
+	-root["Removed"]: gone (string) [line 11]
+
+
+`,
+		},
+		{
+			name: "byte-diff",
+			args: []string{"--byte-diff", flagdata("show-size", "a"), flagdata("show-size", "b")},
+			want: `changed.plist:
+	-root["Name"]: old (string)
+	+root["Name"]: newer (string)
+
+same.plist:
+	-byte 170: 3e0a3c646963743e[0a]093c6b65793e436f
+	+byte 170: 3e0a3c646963743e[3c]6b65793e436f756e
+
+
+`,
+		},
+		{
+			name: "byte-diff at the start",
+			args: []string{"--byte-diff", flagdata("basic", "a"), flagdata("binary", "a")},
+			want: `prefs.plist:
+	-byte 0: [3c]3f786d6c20766572
+	+byte 0: [62]706c6973743030d4
+
+
+`,
+		},
+		{
+			name: "print0",
+			args: []string{"--name-only", "--print0", flagdata("print0", "a"), flagdata("print0", "b")},
+			want: "Big Sur.plist\x00other.plist\x00",
+		},
+		{
+			name: "print0 short flag",
+			args: []string{"--name-only", "-z", flagdata("print0", "a"), flagdata("print0", "b")},
+			want: "Big Sur.plist\x00other.plist\x00",
+		},
+		{
+			name:    "print0 without name-only",
+			args:    []string{"--print0", flagdata("print0", "a"), flagdata("print0", "b")},
+			wantErr: "--print0 requires --name-only",
+		},
+		{
+			name: "ignore-uuids",
+			args: []string{"--ignore-uuids", flagdata("ignore-uuids", "a"), flagdata("ignore-uuids", "b")},
+			want: `prefs.plist:
+	-root["Token"]: 9A8B7C6D-5E4F-4A3B-2C1D-0E9F8A7B6C5D (string)
+	+root["Token"]: none (string)
+
+
+`,
+		},
+		{
+			name: "ignore-uuids-path",
+			args: []string{"--ignore-uuids", "--ignore-uuids-path", "Session", flagdata("ignore-uuids", "a"), flagdata("ignore-uuids", "b")},
+			want: `prefs.plist:
+	-root["Device"]: 0C4A3B5E-1F2D-4E6A-9B8C-7D6E5F4A3B2C (string)
+	+root["Device"]: 6F7E8D9C-0B1A-4F2E-8D3C-4B5A6F7E8D9C (string)
+
+	-root["Token"]: 9A8B7C6D-5E4F-4A3B-2C1D-0E9F8A7B6C5D (string)
+	+root["Token"]: none (string)
+
+
+`,
+		},
+		{
+			name: "output-encoding utf-8",
+			args: []string{"--output-encoding=utf-8", flagdata("output-encoding", "a"), flagdata("output-encoding", "b")},
+			want: `prefs.plist:
+	-root["Name"]: cafe (string)
+	+root["Name"]: café ☕ 😀 (string)
+
+
+`,
+		},
+		{
+			name: "output-encoding escape",
+			args: []string{"--output-encoding=escape", flagdata("output-encoding", "a"), flagdata("output-encoding", "b")},
+			want: `prefs.plist:
+	-root["Name"]: cafe (string)
+	+root["Name"]: caf\u00e9 \u2615 \ud83d\ude00 (string)
+
+
+`,
+		},
+		{
+			name: "output-encoding ascii",
+			args: []string{"--output-encoding=ascii", flagdata("output-encoding", "a"), flagdata("output-encoding", "b")},
+			want: `prefs.plist:
+	-root["Name"]: cafe (string)
+	+root["Name"]: caf? ? ? (string)
+
+
+`,
+		},
+		{
+			name: "reference",
+			args: []string{"--reference", flagdata("reference", "reference.plist"), flagdata("reference", "a"), flagdata("reference", "b")},
+			want: `prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+	-root["Window"]["Width"]: 1 (uint64)
+	+root["Window"]["Width"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "ignore-counters",
+			args: []string{"--ignore-counters", flagdata("ignore-counters", "a"), flagdata("ignore-counters", "b")},
+			want: `prefs.plist:
+	-root["Down"]: 5 (uint64)
+	+root["Down"]: 4 (uint64)
+
+	-root["Jump"]: 5 (uint64)
+	+root["Jump"]: 50 (uint64)
+
+	-root["Serial"]: 7 (uint64)
+	+root["Serial"]: 10 (uint64)
+
+
+`,
+		},
+		{
+			name: "ignore-counters counter-window",
+			args: []string{"--ignore-counters", "--counter-window", "3", flagdata("ignore-counters", "a"), flagdata("ignore-counters", "b")},
+			want: `prefs.plist:
+	-root["Down"]: 5 (uint64)
+	+root["Down"]: 4 (uint64)
+
+	-root["Jump"]: 5 (uint64)
+	+root["Jump"]: 50 (uint64)
+
+
+`,
+		},
+		{
+			name:    "stats-json without othertree",
+			args:    []string{"--stats-json", flagdata("basic", "a")},
+			wantErr: "--stats-json requires othertree",
+		},
+		{
+			name: "defaults",
+			args: []string{"--defaults", flagdata("defaults", "defaults.plist"), flagdata("defaults", "a"), flagdata("defaults", "b")},
+			want: `prefs.plist:
+	+root["AutoSave"]: false (bool)
+
+
+`,
+		},
+		{
+			name: "without defaults",
+			args: []string{flagdata("defaults", "a"), flagdata("defaults", "b")},
+			want: `prefs.plist:
+	+root["AutoSave"]: false (bool)
+
+	-root["Theme"]: light (string)
+
+	+root["Window"]["Width"]: 800 (uint64)
+
+
+`,
+		},
+		{
+			name: "fuzzy-keys",
+			args: []string{"--fuzzy-keys", flagdata("fuzzy-keys", "a"), flagdata("fuzzy-keys", "b")},
+			want: `prefs.plist:
+	+root["SHOW_ALL"]: true (bool)
+
+	-root["ShowAll"]: true (bool)
+
+	-root["auto_save"]: true (bool)
+	+root["auto_save"]: false (bool) [renamed from AutoSave]
+
+	-root["myKey"]: value (string)
+	+root["myKey"]: value (string) [renamed from MyKey, value unchanged]
+
+	+root["show_all"]: true (bool)
+
+
+`,
+		},
+		{
+			name: "compare-raw-on-decode-failure",
+			args: []string{"--compare-raw-on-decode-failure", flagdata("raw-fallback", "a"), flagdata("raw-fallback", "b")},
+			want: `broken.plist:
+	-root: <unparseable>
+	+root: <unparseable> [bytes differ]
+
+
+`,
+			wantStderr: "warning: broken.plist could not be parsed as a plist\n",
+		},
+		{
+			name: "compare-raw-on-decode-failure same bytes",
+			args: []string{"--compare-raw-on-decode-failure", flagdata("raw-fallback", "a"), flagdata("raw-fallback", "c")},
+			want: "",
+		},
+		{
+			name: "without compare-raw-on-decode-failure",
+			args: []string{flagdata("raw-fallback", "a"), flagdata("raw-fallback", "b")},
+			want: "",
+		},
+		{
+			name: "skip-large-data",
+			args: []string{"--skip-large-data", "32", flagdata("skip-large-data", "a"), flagdata("skip-large-data", "b")},
+			want: `prefs.plist:
+	-root["Small"][2]: 99 (uint8)
+	+root["Small"][2]: 100 (uint8)
+
+
+`,
+		},
+		{
+			name: "skip-large-data at the length",
+			args: []string{"--skip-large-data", "64", "--skip-file", "grows.plist", flagdata("skip-large-data", "a"), flagdata("skip-large-data", "b")},
+			want: `prefs.plist:
+	-root["Icon"][63]: 0 (uint8)
+	+root["Icon"][63]: 1 (uint8)
+
+	-root["Small"][2]: 99 (uint8)
+	+root["Small"][2]: 100 (uint8)
+
+
+`,
+		},
+		{
+			name: "batch",
+			args: []string{"batch", flagdata("batch", "manifest.plist")},
+			want: `== one ==
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+== two/a vs two/b ==
+no changes
+
+1 of 2 pairs differed: one
+`,
+		},
+		{
+			name: "batch json",
+			args: []string{"batch", "--json", flagdata("batch", "manifest.plist")},
+			want: fmt.Sprintf(`{
+  "pairs": [
+    {
+      "label": "one",
+      "a": %q,
+      "b": %q,
+      "equal": false,
+      "files": [
+        {
+          "file": "prefs.plist",
+          "diffs": [
+            {
+              "path": "root[\"Count\"]",
+              "old": 1,
+              "new": 2
+            }
+          ]
+        }
+      ]
+    },
+    {
+      "label": "two/a vs two/b",
+      "a": %q,
+      "b": %q,
+      "equal": true
+    }
+  ],
+  "total": 2,
+  "differed": 1
+}
+`, absFlagdata("batch", "one", "a"), absFlagdata("batch", "one", "b"), absFlagdata("batch", "two", "a"), absFlagdata("batch", "two", "b")),
+		},
+		{
+			name: "grep-key only lists files with the key",
+			args: []string{"grep-key", "root.Settings.Theme", flagdata("grep-key", "a")},
+			want: "nested/three.plist: light (string)\none.plist: dark (string)\n",
+		},
+		{
+			name: "grep-key without root",
+			args: []string{"grep-key", "Settings.Theme", flagdata("grep-key", "a")},
+			want: "nested/three.plist: light (string)\none.plist: dark (string)\n",
+		},
+		{
+			name: "grep-key with a key starting with root",
+			args: []string{"grep-key", "rootless.Foo", flagdata("grep-key", "a")},
+			want: "one.plist: 1 (uint64)\n",
+		},
+		{
+			name: "grep-key two trees",
+			args: []string{"grep-key", "root.Settings.Theme", flagdata("grep-key", "a"), flagdata("grep-key", "b")},
+			want: "one.plist: dark (string) → light (string)\ntwo.plist: <missing> → dark (string)\n",
+		},
+		{
+			name: "fanout",
+			args: []string{"fanout", "--file", "com.example.plist", flagdata("fanout", "Users", "*", "Library", "Preferences")},
+			want: `root["LaunchCount"]:
+	3 (uint64): alice, carol
+	5 (uint64): bob
+root["Theme"]:
+	dark (string): alice, bob
+	light (string): carol
+`,
+		},
+		{
+			name: "fanout ignore-key",
+			args: []string{"fanout", "--file", "com.example.plist", "--ignore-key", "LaunchCount", flagdata("fanout", "Users", "*", "Library", "Preferences")},
+			want: `root["Theme"]:
+	dark (string): alice, bob
+	light (string): carol
+`,
+		},
+		{
+			name: "fanout timestamps",
+			args: []string{"fanout", "--file", "com.example.plist", "--timestamps", "--ignore-key", "LaunchCount", flagdata("fanout", "Users", "*", "Library", "Preferences")},
+			want: `root["LastOpened"]:
+	2021-01-01 00:00:00 +0000 UTC (time.Time): alice
+	2021-02-01 00:00:00 +0000 UTC (time.Time): bob
+	2021-03-01 00:00:00 +0000 UTC (time.Time): carol
+root["Theme"]:
+	dark (string): alice, bob
+	light (string): carol
+`,
+		},
+		{
+			name: "base with a change under a removed dict",
+			args: []string{"--base", flagdata("base-parent", "base"), flagdata("base-parent", "a"), flagdata("base-parent", "b")},
+			want: `prefs.plist:
+	[conflict] root["Window"]
+		base: map[Height:100 Width:200] (map[string]interface {})
+		a:    map[Height:150 Width:200] (map[string]interface {})
+		b:    <missing>
+
+`,
+		},
+		{
+			name: "log-level warn",
+			args: []string{"--log-level=warn", "--compare-raw-on-decode-failure", flagdata("raw-fallback", "a"), flagdata("raw-fallback", "b")},
+			want: `broken.plist:
+	-root: <unparseable>
+	+root: <unparseable> [bytes differ]
+
+
+`,
+			wantStderr: "warning: broken.plist could not be parsed as a plist\n",
+		},
+		{
+			name: "log-level error",
+			args: []string{"--log-level=error", "--compare-raw-on-decode-failure", flagdata("raw-fallback", "a"), flagdata("raw-fallback", "b")},
+			want: `broken.plist:
+	-root: <unparseable>
+	+root: <unparseable> [bytes differ]
+
+
+`,
+			noStderr: true,
+		},
+		{
+			name: "changed UID",
+			args: []string{flagdata("uid", "a"), flagdata("uid", "b")},
+			want: `archive.plist:
+	-root["Root"]: UID(1) (plist.UID)
+	+root["Root"]: UID(3) (plist.UID)
+
+
+`,
+		},
+		{
+			name: "dump UID with plist types",
+			args: []string{"dump", "--plist-types", flagdata("uid", "a", "archive.plist")},
+			want: `format: XML
+root: (Dict, 2 entries)
+  "Name": same (String)
+  "Root": UID(1) (UID)
+`,
+		},
+		{
+			name: "single file against directory",
+			args: []string{flagdata("single-file", "a", "foo.plist"), flagdata("single-file", "b")},
+			want: `bar.plist:
+	-root: <missing>
+	+root: map[Name:bar] (map[string]interface {})
+
+foo.plist:
+	-root["Name"]: one (string)
+	+root["Name"]: two (string)
+
+
+`,
+		},
+		{
+			name: "directory against single file",
+			args: []string{"--name-only", flagdata("single-file", "b"), flagdata("single-file", "a", "foo.plist")},
+			want: "bar.plist\nfoo.plist\n",
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(td.args, &stdout, &stderr)
+			if td.wantErr != "" {
+				if code == 0 || !strings.Contains(stderr.String(), td.wantErr) {
+					t.Errorf("exit code %d and stderr %q, want an error containing %q", code, stderr.String(), td.wantErr)
+				}
+				return
+			}
+			if code != 0 {
+				t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+			}
+			if diff := cmp.Diff(td.want, timestamp.ReplaceAllString(stdout.String(), "TIME")); diff != "" {
+				t.Errorf("stdout (-want +got):\n%s", diff)
+			}
+			if td.noStderr && stderr.Len() > 0 {
+				t.Errorf("unexpected stderr: %s", stderr.String())
+			}
+			if td.wantStderr == "" {
+				return
+			}
+			if diff := cmp.Diff(td.wantStderr, stderr.String()); diff != "" {
+				t.Errorf("stderr (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// copyTree copies the flagdata tree name into dir
+func copyTree(t *testing.T, name, dir string) {
+	t.Helper()
+	src := flagdata(name)
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, rel)
+		err = os.MkdirAll(filepath.Dir(dest), 0o700)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dest, data, 0o600)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mirrorTree copies the flagdata tree name into dir and removes the files in dir that aren't in it
+func mirrorTree(t *testing.T, name, dir string) {
+	t.Helper()
+	src := flagdata(name)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stat(filepath.Join(src, rel))
+		if errors.Is(err, fs.ErrNotExist) {
+			return os.Remove(path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyTree(t, name, dir)
+}
+
+// watchTree copies the flagdata tree name to a temporary directory for watch to change
+func watchTree(t *testing.T, name string) string {
+	t.Helper()
+	dir := t.TempDir()
+	copyTree(t, name, dir)
+	return dir
+}
+
+// enterReader is stdin for --watch-once. It calls change before pressing Enter.
+type enterReader struct {
+	change func()
+}
+
+func (r *enterReader) Read(p []byte) (int, error) {
+	if r.change == nil {
+		return 0, io.EOF
+	}
+	r.change()
+	r.change = nil
+	return copy(p, "\n"), nil
+}
+
+func TestWatchOnce(t *testing.T) {
+	dir := watchTree(t, "watch/a")
+	var stdout, stderr bytes.Buffer
+	d := &differ{}
+	stdin := &enterReader{change: func() {
+		copyTree(t, "watch/b", dir)
+	}}
+	err := d.watchOnce(dir, stdin, &stdout, &stderr, &formatter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		t.Errorf("stdout (-want +got):\n%s", diff)
+	}
+	if got := stderr.String(); got != "baseline captured, make your change and press Enter\n" {
+		t.Errorf("unexpected stderr %q", got)
+	}
+}
+
+// timestamp matches the RFC 3339 timestamps output is labeled with
+var timestamp = regexp.MustCompile(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)`)
+
+// clockTime matches the times of day watch summaries are labeled with
+var clockTime = regexp.MustCompile(`\b\d\d:\d\d:\d\d\b`)
+
+// relativeStamp matches the labels from --relative-time
+var relativeStamp = regexp.MustCompile(`\+(\d+:)?\d\d:\d\d\.\d`)
+
+// watchFlags runs watch with args on a copy of the flagdata tree name/a, or just the file filename in
+// it when filename isn't empty. The copy is snapshotted for --since and then changed to name/b.
+// Watch exits with --until-change after the first changes. It returns stdout with the times masked
+// by maskTimes, and stderr.
+func watchFlags(t *testing.T, name, filename string, args ...string) (string, string) {
+	t.Helper()
+	fastWatch(t)
+	dir := watchTree(t, name+"/a")
+	watched := filepath.Join(dir, filename)
+	since := sinceFile(t, watched)
+	mirrorTree(t, name+"/b", dir)
+	args = append([]string{watched, "--since", since, "--until-change"}, args...)
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	return maskTimes(stdout.String()), stderr.String()
+}
+
+// maskTimes replaces timestamps and times of day in watch output with TIME and relative times with
+// +TIME.
+func maskTimes(out string) string {
+	out = timestamp.ReplaceAllString(out, "TIME")
+	out = relativeStamp.ReplaceAllString(out, "+TIME")
+	return clockTime.ReplaceAllString(out, "TIME")
+}
+
+// watchStep changes the watched tree while watchSteps is running
+type watchStep struct {
+	// wait is output on stdout or stderr to wait for before changing the tree
+	wait string
+	// delay is how long to wait after wait is output
+	delay time.Duration
+	// tree is the flagdata tree to mirror into the watched copy. When it's empty, the step only waits.
+	tree string
+}
+
+// watchSteps is watchFlags without --until-change. After name/b, the watched copy is changed by each
+// of steps in turn. Watch is stopped a few ticks after the last step, so output that is repeated on
+// later ticks shows up. It returns stdout and stderr without masking the times.
+func watchSteps(t *testing.T, name string, steps []watchStep, args ...string) (string, string) {
+	t.Helper()
+	fastWatch(t)
+	dir := watchTree(t, name+"/a")
+	since := sinceFile(t, dir)
+	mirrorTree(t, name+"/b", dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	origContext := baseContext
+	baseContext = func() context.Context { return ctx }
+	t.Cleanup(func() { baseContext = origContext })
+	args = append([]string{dir, "--since", since}, args...)
+	var stdout, stderr lockedBuffer
+	done := make(chan int, 1)
+	go func() {
+		done <- run(args, &stdout, &stderr)
+	}()
+	for _, step := range steps {
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			if strings.Contains(stdout.String()+stderr.String(), step.wait) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q. stdout:\n%s\nstderr:\n%s", step.wait, stdout.String(), stderr.String())
+			}
+		}
+		time.Sleep(step.delay)
+		if step.tree != "" {
+			mirrorTree(t, step.tree, dir)
+		}
+	}
+	time.Sleep(10 * watchInterval)
+	cancel()
+	code := <-done
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	return stdout.String(), stderr.String()
+}
+
+// fastWatch shortens watchInterval for the rest of the test
+func fastWatch(t *testing.T) {
+	interval := watchInterval
+	watchInterval = 10 * time.Millisecond
+	t.Cleanup(func() { watchInterval = interval })
+}
+
+// sinceFile writes a snapshot of the tree at watched to a file for --since and returns its name
+func sinceFile(t *testing.T, watched string) string {
+	t.Helper()
+	d := &differ{}
+	fsys, err := d.getFS(watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := d.plSnapshot(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = writeSnapshot(&buf, watched, snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := filepath.Join(t.TempDir(), "since.snapshot")
+	err = os.WriteFile(since, buf.Bytes(), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return since
+}
+
+// setStdin replaces os.Stdin with the file filename for the rest of the test
+func setStdin(t *testing.T, filename string) {
+	t.Helper()
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close() //nolint:errcheck // only reading
+	})
+}
+
+func TestSinceStdin(t *testing.T) {
+	fastWatch(t)
+	dir := watchTree(t, "watch/a")
+	setStdin(t, sinceFile(t, dir))
+	copyTree(t, "watch/b", dir)
+	var stdout, stderr bytes.Buffer
+	code := run([]string{dir, "--since", "-", "--until-change"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	want := `[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`
+	if diff := cmp.Diff(want, timestamp.ReplaceAllString(stdout.String(), "TIME")); diff != "" {
+		t.Errorf("stdout (-want +got):\n%s", diff)
+	}
+}
+
+func TestSinceStdinNotSnapshot(t *testing.T) {
+	setStdin(t, flagdata("watch", "a", "prefs.plist"))
+	var stdout, stderr bytes.Buffer
+	code := run([]string{flagdata("watch", "a"), "--since", "-"}, &stdout, &stderr)
+	want := "stdin: not a plist-diff snapshot"
+	if code == 0 || !strings.Contains(stderr.String(), want) {
+		t.Errorf("exit code %d and stderr %q, want an error containing %q", code, stderr.String(), want)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	watchFlags(t, "watch", "", "--on-change", `printf "%s\n" "$@" "$PLIST_DIFF_FILES" > `+out)
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "prefs.plist\nprefs.plist\n"
+	if string(got) != want {
+		t.Errorf("on-change command wrote %q, want %q", got, want)
+	}
+}
+
+func TestWatchFlags(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		// filename is the file to watch instead of the whole tree
+		filename string
+		args     []string
+		want     string
+		// wantStderr is compared to stderr when it isn't empty
+		wantStderr string
+		// tree is the flagdata tree to watch instead of watch
+		tree string
+		// steps change the tree after tree/b. Watch runs without --until-change when there are steps.
+		steps []watchStep
+	}{
+		{
+			// go test doesn't run tests with a terminal for stdout
+			name: "append when stdout is not a terminal",
+			want: `[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "settle",
+			args: []string{"--settle=10ms"},
+			want: `[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "jsonl",
+			args: []string{"--format=jsonl"},
+			want: `{"time":"TIME","file":"prefs.plist","diffs":[{"path":"root[\"Count\"]","old":1,"new":2}]}
+`,
+		},
+		{
+			name: "no-live",
+			args: []string{"--no-live"},
+			want: `[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "digest",
+			args: []string{"--digest"},
+			want: `[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+			wantStderr: "b48dd22a8393cc773361fc7b80895bf929fc8993e8aab95d234fefb26aa6df18\n",
+		},
+		{
+			name:     "until-change a file",
+			filename: "prefs.plist",
+			want:     "[TIME] root[\"Count\"]: 1 → 2\n",
+		},
+		{
+			name: "watch-summary",
+			args: []string{"--watch-summary"},
+			want: "1 files changed: prefs.plist (1) — last change TIME\n",
+		},
+		{
+			name:     "watch-summary a file",
+			filename: "prefs.plist",
+			args:     []string{"--watch-summary"},
+			want:     "1 files changed: prefs.plist (1) — last change TIME\n",
+		},
+		{
+			name: "relative-time",
+			args: []string{"--relative-time"},
+			want: `[+TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			name: "removed file is reported once",
+			tree: "watch-remove",
+			steps: []watchStep{
+				{wait: "file removed: lock.plist", tree: "watch-remove/c"},
+				{wait: `+root["Count"]`},
+			},
+			want: `[TIME]
+file removed: lock.plist
+
+[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`,
+		},
+		{
+			// the second write lands while watch waits for the first to settle
+			name: "settle two writes",
+			tree: "watch-settle",
+			args: []string{"--settle=500ms", "--log-level=debug"},
+			steps: []watchStep{
+				{wait: "to settle", tree: "watch-settle/c"},
+				{wait: `+root["Count"]`},
+			},
+			want: `[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 3 (uint64)
+
+
+`,
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			tree := td.tree
+			if tree == "" {
+				tree = "watch"
+			}
+			var stdout, stderr string
+			if len(td.steps) > 0 {
+				stdout, stderr = watchSteps(t, tree, td.steps, td.args...)
+				stdout = maskTimes(stdout)
+			} else {
+				stdout, stderr = watchFlags(t, tree, td.filename, td.args...)
+			}
+			if diff := cmp.Diff(td.want, stdout); diff != "" {
+				t.Errorf("stdout (-want +got):\n%s", diff)
+			}
+			if td.wantStderr == "" {
+				return
+			}
+			if diff := cmp.Diff(td.wantStderr, stderr); diff != "" {
+				t.Errorf("stderr (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWatchRelativeTime(t *testing.T) {
+	steps := []watchStep{
+		{wait: `+root["Count"]: 2`, delay: 300 * time.Millisecond, tree: "watch-relative/c"},
+		{wait: `+root["Count"]: 3`},
+	}
+	stdout, _ := watchSteps(t, "watch-relative", steps, "--relative-time")
+	stamps := relativeStamp.FindAllString(stdout, -1)
+	if len(stamps) != 2 {
+		t.Fatalf("want 2 relative times, got %q in:\n%s", stamps, stdout)
+	}
+	offsets := make([]time.Duration, len(stamps))
+	for i, stamp := range stamps {
+		// +1:00:02.5 or +00:02.5
+		parts := strings.Split(strings.TrimPrefix(stamp, "+"), ":")
+		for len(parts) < 3 {
+			parts = append([]string{"0"}, parts...)
+		}
+		offset, err := time.ParseDuration(parts[0] + "h" + parts[1] + "m" + parts[2] + "s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets[i] = offset
+	}
+	if offsets[1] <= offsets[0] {
+		t.Errorf("relative times should increase, got %q in:\n%s", stamps, stdout)
+	}
+	want := `[+TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+[+TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 3 (uint64)
+
+
+`
+	if diff := cmp.Diff(want, maskTimes(stdout)); diff != "" {
+		t.Errorf("stdout (-want +got):\n%s", diff)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that can be written and read from different goroutines
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor waits up to 5 seconds for buf to contain all of want
+func waitFor(t *testing.T, buf *lockedBuffer, want ...string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		got := buf.String()
+		found := 0
+		for _, w := range want {
+			if strings.Contains(got, w) {
+				found++
+			}
+		}
+		if found == len(want) {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %q in:\n%s", want, buf.String())
+}
+
+// writeWatchTargets writes a watch-targets config with a target for each tree and prefix pair
+func writeWatchTargets(t *testing.T, treesAndPrefixes ...string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<plist version="1.0">` + "\n<array>\n")
+	for i := 0; i < len(treesAndPrefixes); i += 2 {
+		fmt.Fprintf(&b, "\t<dict>\n\t\t<key>tree</key>\n\t\t<string>%s</string>\n", treesAndPrefixes[i])
+		fmt.Fprintf(&b, "\t\t<key>prefix</key>\n\t\t<string>%s</string>\n", treesAndPrefixes[i+1])
+		b.WriteString("\t\t<key>log-level</key>\n\t\t<string>debug</string>\n\t</dict>\n")
+	}
+	b.WriteString("</array>\n</plist>\n")
+	config := filepath.Join(t.TempDir(), "targets.plist")
+	err := os.WriteFile(config, []byte(b.String()), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestWatchTargets(t *testing.T) {
+	fastWatch(t)
+	one, two := watchTree(t, "watch/a"), watchTree(t, "watch/a")
+	cmd := &watchTargetsCmd{Config: writeWatchTargets(t, one, "one", two, "two")}
+	var stdout, stderr lockedBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.watch(ctx, &stdout, &stderr)
+	}()
+	// both targets have their snapshots once they have read their trees
+	waitFor(t, &stderr, "[one] debug: read "+one, "[two] debug: read "+two)
+	copyTree(t, "watch/b", one)
+	copyTree(t, "watch/b", two)
+	waitFor(t, &stdout, "[one] \t+root", "[two] \t+root")
+	cancel()
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"[one] ", "[two] "} {
+		var got []string
+		for _, line := range strings.SplitAfter(stdout.String(), "\n") {
+			if strings.HasPrefix(line, prefix) {
+				got = append(got, timestamp.ReplaceAllString(strings.TrimPrefix(line, prefix), "TIME"))
+			}
+		}
+		// the first tick reports that nothing has changed yet
+		want := `[TIME]
+no changes
+
+[TIME]
+prefs.plist:
+	-root["Count"]: 1 (uint64)
+	+root["Count"]: 2 (uint64)
+
+
+`
+		if diff := cmp.Diff(want, strings.Join(got, "")); diff != "" {
+			t.Errorf("%s output (-want +got):\n%s", prefix, diff)
+		}
+	}
+}
+
+func TestWatchTargetsError(t *testing.T) {
+	fastWatch(t)
+	missing := filepath.Join(t.TempDir(), "missing")
+	cmd := &watchTargetsCmd{Config: writeWatchTargets(t, watchTree(t, "watch/a"), "ok", missing, "missing")}
+	var stdout, stderr lockedBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.watch(context.Background(), &stdout, &stderr)
+	}()
+	// the ok target only stops when the failed one cancels it
+	select {
+	case err := <-done:
+		want := "missing: stat " + missing
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("got error %v, want one starting with %q", err, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch-targets didn't stop after a target failed")
+	}
+}
+
+func TestCheckMtime(t *testing.T) {
+	a, b := watchTree(t, "watch/a"), watchTree(t, "watch/a")
+	for dir, day := range map[string]int{a: 2, b: 3} {
+		mtime := time.Date(2024, 1, day, 3, 4, 5, 0, time.UTC)
+		err := os.Chtimes(filepath.Join(dir, "prefs.plist"), mtime, mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--check-mtime", a, b}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	want := `prefs.plist:
+	-mtime: 2024-01-02 03:04:05 +0000 UTC (time.Time)
+	+mtime: 2024-01-03 03:04:05 +0000 UTC (time.Time)
+
+
+`
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		t.Errorf("stdout (-want +got):\n%s", diff)
+	}
+	stdout.Reset()
+	code = run([]string{a, b}, &stdout, &stderr)
+	if code != 0 || stdout.Len() != 0 {
+		t.Errorf("without --check-mtime got exit code %d and stdout %q", code, stdout.String())
+	}
+}
+
+func TestURLTree(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prefs.plist":
+			http.ServeFile(w, r, flagdata("basic", "b", "prefs.plist"))
+		case "/slow.plist":
+			<-release
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	for _, td := range []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "url",
+			args: []string{"--name-only", flagdata("basic", "a", "prefs.plist"), srv.URL + "/prefs.plist"},
+			want: "prefs.plist\n",
+		},
+		{
+			name:    "not found",
+			args:    []string{flagdata("basic", "a", "prefs.plist"), srv.URL + "/missing.plist"},
+			wantErr: "404 Not Found",
+		},
+		{
+			name:    "timeout",
+			args:    []string{"--timeout=50ms", flagdata("basic", "a", "prefs.plist"), srv.URL + "/slow.plist"},
+			wantErr: "Client.Timeout exceeded",
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(td.args, &stdout, &stderr)
+			if td.wantErr != "" {
+				if code == 0 || !strings.Contains(stderr.String(), td.wantErr) {
+					t.Errorf("exit code %d and stderr %q, want an error containing %q", code, stderr.String(), td.wantErr)
+				}
+				return
+			}
+			if code != 0 {
+				t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+			}
+			if diff := cmp.Diff(td.want, stdout.String()); diff != "" {
+				t.Errorf("stdout (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMaxNestingDefault(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	for dir, val := range map[string]string{a: "a", b: "b"} {
+		data := xmlPlist(nestedPlist(1000, "<string>"+val+"</string>"))
+		err := os.WriteFile(filepath.Join(dir, "deep.plist"), []byte(data), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	code := run([]string{a, b}, &stdout, &stderr)
+	want := "deep.plist: dicts and arrays are nested more than 256 levels deep"
+	if code == 0 || !strings.Contains(stderr.String(), want) {
+		t.Errorf("exit code %d and stderr %q, want an error containing %q", code, stderr.String(), want)
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	for _, td := range []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{elapsed: 0, want: "+00:00.0"},
+		{elapsed: 2590 * time.Millisecond, want: "+00:02.5"},
+		{elapsed: 59*time.Minute + 59*time.Second + 999*time.Millisecond, want: "+59:59.9"},
+		{elapsed: time.Hour + 2500*time.Millisecond, want: "+1:00:02.5"},
+		{elapsed: 26*time.Hour + 3*time.Minute, want: "+26:03:00.0"},
+	} {
+		if got := relativeTime(td.elapsed); got != td.want {
+			t.Errorf("relativeTime(%s) = %q, want %q", td.elapsed, got, td.want)
+		}
+	}
+}
+
+func TestWalkPlists(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.plist":           {Data: []byte(`<plist version="1.0"><dict><key>Name</key><string>a</string></dict></plist>`)},
+		"dir/b.plist":       {Data: []byte(`<plist version="1.0"><array><integer>1</integer></array></plist>`)},
+		"dir/skipped.plist": {Data: []byte(`<plist version="1.0"><string>skipped</string></plist>`)},
+		"broken.plist":      {Data: []byte(`not a plist`)},
+		"notes.txt":         {Data: []byte(`<plist version="1.0"><string>notes</string></plist>`)},
+	}
+	var stderr bytes.Buffer
+	d := &differ{
+		SkipFiles: map[string]bool{"skipped.plist": true},
+		Log:       newLogger(&stderr, "warn"),
+	}
+	got := map[string]interface{}{}
+	err := d.WalkPlists(fsys, func(path string, decoded interface{}) error {
+		got[path] = decoded
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a.plist":     map[string]interface{}{"Name": "a"},
+		"dir/b.plist": []interface{}{uint64(1)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("visited (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("warning: broken.plist could not be parsed as a plist\n", stderr.String()); diff != "" {
+		t.Errorf("stderr (-want +got):\n%s", diff)
+	}
+
+	// files without WhereKey aren't visited
+	d.WhereKey = []string{"Name"}
+	got = map[string]interface{}{}
+	err = d.WalkPlists(fsys, func(path string, decoded interface{}) error {
+		got[path] = decoded
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"a.plist": want["a.plist"]}, got); diff != "" {
+		t.Errorf("visited with WhereKey (-want +got):\n%s", diff)
+	}
+	d.WhereKey = nil
+
+	stop := fmt.Errorf("stop")
+	var visited []string
+	err = d.WalkPlists(fsys, func(path string, decoded interface{}) error {
+		visited = append(visited, path)
+		return stop
+	})
+	if err != stop {
+		t.Errorf("got error %v, want the error from fn", err)
+	}
+	if diff := cmp.Diff([]string{"a.plist"}, visited); diff != "" {
+		t.Errorf("visited after the error (-want +got):\n%s", diff)
+	}
+}
+
+func TestSingleFileKey(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		want string
+	}{
+		{name: "foo.plist", want: "foo.plist"},
+		{name: "dir/foo.plist", want: "foo.plist"},
+		{name: "/abs/dir/foo.plist", want: "foo.plist"},
+		{name: "dir/foo", want: "foo.plist"},
+		{name: "dir/foo.xml", want: "foo.xml.plist"},
+		{name: "https://example.com/prefs/foo.plist?v=1", want: "foo.plist"},
+		{name: "https://example.com/", want: singleFileName},
+		{name: "/", want: singleFileName},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			if got := singleFileKey(td.name); got != td.want {
+				t.Errorf("got %q, want %q", got, td.want)
+			}
+		})
+	}
+	// a file given by itself is keyed like the same file found in its directory
+	dirFS := os.DirFS(flagdata("single-file", "a"))
+	d := &differ{}
+	fileFS, err := d.getFS(flagdata("single-file", "a", "foo.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fsys := range []fs.FS{dirFS, fileFS} {
+		_, err = fs.Stat(fsys, singleFileKey(flagdata("single-file", "a", "foo.plist")))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PLIST_DIFF_TEST_DIR", "dir")
+	for _, td := range []struct {
+		path string
+		want string
+	}{
+		{path: "~/foo", want: home + "/foo"},
+		{path: "$HOME/foo", want: home + "/foo"},
+		{path: "${HOME}/foo", want: home + "/foo"},
+		{path: "~", want: home},
+		{path: "~/$PLIST_DIFF_TEST_DIR/foo", want: home + "/dir/foo"},
+		{path: "~user/foo", want: "~user/foo"},
+		{path: "foo/~/bar", want: "foo/~/bar"},
+		{path: "foo", want: "foo"},
+	} {
+		td := td
+		t.Run(td.path, func(t *testing.T) {
+			got, err := expandPath(td.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != td.want {
+				t.Errorf("got %q, want %q", got, td.want)
+			}
+		})
+	}
+}
+
+func TestDifferOptions(t *testing.T) {
+	a := fstest.MapFS{"prefs.plist": {Data: []byte(`<plist version="1.0"><dict><key>Name</key><string>Foo</string></dict></plist>`)}}
+	b := fstest.MapFS{"prefs.plist": {Data: []byte(`<plist version="1.0"><dict><key>Name</key><string>FOO</string></dict></plist>`)}}
+	for _, td := range []struct {
+		name    string
+		options []cmp.Option
+		wantEq  bool
+	}{
+		{name: "default", wantEq: false},
+		{
+			name:    "case insensitive comparer",
+			options: []cmp.Option{cmp.Comparer(strings.EqualFold)},
+			wantEq:  true,
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			d := &differ{Options: td.options}
+			eq, diff, err := d.diffFS(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if eq != td.wantEq {
+				t.Errorf("got equal %t, want %t:\n%s", eq, td.wantEq, diff)
+			}
+		})
+	}
+}
+
+func TestDatesCompareByInstant(t *testing.T) {
+	instant := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	a := map[string]interface{}{"Date": instant, "Dates": []interface{}{instant}}
+	b := map[string]interface{}{
+		"Date":  instant.In(time.FixedZone("EST", -5*60*60)),
+		"Dates": []interface{}{instant.In(time.FixedZone("JST", 9*60*60))},
+	}
+	later := map[string]interface{}{"Date": instant.Add(time.Second), "Dates": []interface{}{instant}}
+	for _, td := range []struct {
+		name string
+		d    differ
+	}{
+		{name: "default"},
+		{name: "ignore keys", d: differ{IgnoreKeys: []string{"Other"}}},
+		{name: "numeric threshold", d: differ{NumericThreshold: 1}},
+		{name: "normalize objects", d: differ{NormalizeObjects: true}},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			opts := td.d.cmpOptions()
+			if diff := cmp.Diff(a, b, opts...); diff != "" {
+				t.Errorf("same instant in different locations should be equal:\n%s", diff)
+			}
+			if cmp.Equal(a, later, opts...) {
+				t.Error("different instants should not be equal")
+			}
+		})
+	}
+}
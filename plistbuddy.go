@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"howett.net/plist"
+)
+
+// plistBuddyCommand is the path to PlistBuddy on macOS
+const plistBuddyCommand = "/usr/libexec/PlistBuddy"
+
+// plistBuddyScript renders diff as a shell script of PlistBuddy commands that change the files in
+// the old tree to match the new one. It is meant to be run from the old tree's directory.
+//
+// Within a file, deletes come first in reverse order so that removing array elements doesn't shift
+// the indexes of elements still to be removed, followed by sets and then adds.
+func (f *formatter) plistBuddyScript(diff fsDiff) string {
+	s := "#!/bin/sh\nset -e\n"
+	for _, filename := range f.filenames(diff) {
+		if diff[filename].changes() == 0 {
+			continue
+		}
+		s += "\n# " + filename + "\n"
+		for _, line := range plistBuddyFile(filename, diff[filename]) {
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "rm ") {
+				s += line + "\n"
+				continue
+			}
+			s += fmt.Sprintf("%s -c %s %s\n", plistBuddyCommand, shellQuote(line), shellQuote(filename))
+		}
+	}
+	return s
+}
+
+// plistBuddyFile returns the PlistBuddy commands for the diffs in filename. Lines starting with # are
+// comments and lines starting with rm are shell commands.
+func plistBuddyFile(filename string, diffs plistDiff) []string {
+	var deletes, sets, adds []string
+	for i := range diffs {
+		d := &diffs[i]
+		if d.equal || d.keys == nil {
+			continue
+		}
+		if d.old == plistUnparseable || d.new == plistUnparseable {
+			return []string{"# skipped because it could not be parsed as a plist"}
+		}
+		if d.new == plistMissing {
+			return []string{"rm -- " + shellQuote(filename)}
+		}
+		path := plistBuddyEscapedPath(d.keys)
+		switch {
+		case d.old == nil || d.old == plistMissing:
+			adds = append(adds, plistBuddyAdds(d.keys, d.new)...)
+		case d.new == nil:
+			deletes = append(deletes, "Delete "+path)
+		case isComposite(d.old) || isComposite(d.new) || plistBuddyType(d.old) != plistBuddyType(d.new):
+			deletes = append(deletes, "Delete "+path)
+			adds = append(adds, plistBuddyAdds(d.keys, d.new)...)
+		default:
+			val, ok := plistBuddyValue(d.new)
+			if !ok {
+				sets = append(sets, fmt.Sprintf("# can't set %s to %s", path, formatValue(d.new)))
+				continue
+			}
+			sets = append(sets, fmt.Sprintf("Set %s %s", path, val))
+		}
+	}
+	for i, j := 0, len(deletes)-1; i < j; i, j = i+1, j-1 {
+		deletes[i], deletes[j] = deletes[j], deletes[i]
+	}
+	return append(append(deletes, sets...), adds...)
+}
+
+// plistBuddyAdds returns the Add commands that create v at keys. Dicts and arrays are added empty
+// and then filled entry by entry. A root dict is filled without being added.
+func plistBuddyAdds(keys []interface{}, v interface{}) []string {
+	var cmds []string
+	if len(keys) > 0 {
+		typ := plistBuddyType(v)
+		if typ == "" {
+			return []string{fmt.Sprintf("# can't add %s of type %T", plistBuddyEscapedPath(keys), v)}
+		}
+		cmd := fmt.Sprintf("Add %s %s", plistBuddyEscapedPath(keys), typ)
+		if !isComposite(v) {
+			val, ok := plistBuddyValue(v)
+			if !ok {
+				return []string{fmt.Sprintf("# can't add %s with value %s", plistBuddyEscapedPath(keys), formatValue(v))}
+			}
+			cmd += " " + val
+		}
+		cmds = append(cmds, cmd)
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cmds = append(cmds, plistBuddyAdds(appendKey(keys, name), v[name])...)
+		}
+	case []interface{}:
+		for i := range v {
+			cmds = append(cmds, plistBuddyAdds(appendKey(keys, i), v[i])...)
+		}
+	}
+	return cmds
+}
+
+// appendKey returns a copy of keys with key added so that siblings don't share a backing array.
+func appendKey(keys []interface{}, key interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(keys)+1), keys...), key)
+}
+
+// plistBuddyType is the PlistBuddy type name for v or "" when PlistBuddy has no such type.
+func plistBuddyType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case uint64, int64:
+		return "integer"
+	case float64:
+		return "real"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case []byte:
+		return "data"
+	case map[string]interface{}:
+		return "dict"
+	case []interface{}:
+		return "array"
+	default:
+		return ""
+	}
+}
+
+// plistBuddyValue renders a scalar for a PlistBuddy command. It is false for values PlistBuddy
+// can't express, like UIDs and data that isn't text.
+func plistBuddyValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return plistBuddyEscape(v), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case time.Time:
+		return plistBuddyEscape(v.UTC().Format(time.UnixDate)), true
+	case []byte:
+		s := string(v)
+		if !isPrintable(s) {
+			return "", false
+		}
+		return plistBuddyEscape(s), true
+	case plist.UID:
+		return "", false
+	default:
+		return "", false
+	}
+}
+
+// isPrintable is true for valid UTF-8 text without control characters other than whitespace
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r == 0xFFFD || r < ' ' && r != '\n' && r != '\t' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// plistBuddyEscapedPath is plistBuddyPath with each key escaped for a PlistBuddy command.
+func plistBuddyEscapedPath(keys []interface{}) string {
+	escaped := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if s, ok := key.(string); ok {
+			key = plistBuddyEscape(s)
+		}
+		escaped[i] = key
+	}
+	return plistBuddyPath(escaped)
+}
+
+var plistBuddyEscaper = strings.NewReplacer(`\`, `\\`, ` `, `\ `, `"`, `\"`, `'`, `\'`)
+
+// plistBuddyEscape escapes the characters PlistBuddy splits or unquotes command arguments on.
+func plistBuddyEscape(s string) string {
+	return plistBuddyEscaper.Replace(s)
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"runtime/pprof"
+)
+
+// startProfile writes a CPU profile to filename until the returned stop func is called.
+func startProfile(filename string) (func(), error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = pprof.StartCPUProfile(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		_ = file.Close()
+	}, nil
+}
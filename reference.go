@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// readReference reads the key paths of the values in a reference plist. Dicts are followed down to
+// their entries, and everything else, including arrays and empty dicts, is a key path.
+func readReference(filename string) ([][]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if _, ok := val.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%s: must be a dict", filename)
+	}
+	return referencePaths(val, nil), nil
+}
+
+func referencePaths(v interface{}, keys []interface{}) [][]interface{} {
+	dict, ok := v.(map[string]interface{})
+	if !ok || len(dict) == 0 {
+		return [][]interface{}{keys}
+	}
+	names := make([]string, 0, len(dict))
+	for name := range dict {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var paths [][]interface{}
+	for _, name := range names {
+		paths = append(paths, referencePaths(dict[name], appendKey(keys, name))...)
+	}
+	return paths
+}
+
+// applyReference removes the diffs that aren't at or under one of the key paths in paths. A diff
+// above a key path, like a whole file being added, is kept when its old or new value has something
+// at that key path. Pseudo-diffs like mtime are always kept.
+func applyReference(paths [][]interface{}, delta plistDiff) plistDiff {
+	var kept plistDiff
+	for _, d := range delta {
+		if d.keys != nil && !referenced(paths, &d) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// referenced is true when d is at or under one of paths or has a value at one of them
+func referenced(paths [][]interface{}, d *FileDiff) bool {
+	for _, p := range paths {
+		if len(p) <= len(d.keys) {
+			if hasKeyPrefix(d.keys, p) {
+				return true
+			}
+			continue
+		}
+		if !hasKeyPrefix(p, d.keys) {
+			continue
+		}
+		rest := make([]string, 0, len(p)-len(d.keys))
+		for _, key := range p[len(d.keys):] {
+			rest = append(rest, key.(string))
+		}
+		if _, ok := lookupKeyPath(d.old, rest); ok {
+			return true
+		}
+		if _, ok := lookupKeyPath(d.new, rest); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKeyPrefix is true when keys starts with prefix
+func hasKeyPrefix(keys, prefix []interface{}) bool {
+	if len(prefix) > len(keys) {
+		return false
+	}
+	for i := range prefix {
+		if keys[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
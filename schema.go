@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"howett.net/plist"
+)
+
+// schema renders only the key paths that were added or removed and the values whose type changed.
+// Values are never shown.
+func (f *formatter) schema(diff fsDiff) string {
+	var s string
+	for _, filename := range f.filenames(diff) {
+		for _, d := range diff[filename] {
+			if d.equal {
+				continue
+			}
+			switch {
+			case isAbsent(d.old) && isAbsent(d.new):
+			case isAbsent(d.old):
+				s += fmt.Sprintf("+ %s: %s (%s)\n", filename, f.diffPath(&d), plistType(d.new))
+			case isAbsent(d.new):
+				s += fmt.Sprintf("- %s: %s (%s)\n", filename, f.diffPath(&d), plistType(d.old))
+			case plistType(d.old) != plistType(d.new):
+				s += fmt.Sprintf("~ %s: %s (%s -> %s)\n", filename, f.diffPath(&d), plistType(d.old), plistType(d.new))
+			}
+		}
+	}
+	return s
+}
+
+// isAbsent is true when v is nil or a plistState
+func isAbsent(v interface{}) bool {
+	_, ok := v.(plistState)
+	return v == nil || ok
+}
+
+// plistType is the plist name for the type of a decoded value
+func plistType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "Dict"
+	case []interface{}:
+		return "Array"
+	case string:
+		return "String"
+	case bool:
+		return "Bool"
+	case uint64, int64:
+		return "Integer"
+	case float64:
+		return "Real"
+	case time.Time:
+		return "Date"
+	case []byte:
+		return "Data"
+	case plist.UID:
+		return "UID"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// version changes noted on diffs between versions
+const (
+	versionUpgraded   = "upgraded"
+	versionDowngraded = "downgraded"
+)
+
+// semver is a parsed semantic version
+type semver struct {
+	// core is the dot separated numbers like 2, 10 and 0 for 2.10.0. Missing numbers are 0.
+	core []uint64
+	// prerelease is the dot separated identifiers after - like rc and 1 for 2.10.0-rc.1
+	prerelease []string
+}
+
+// parseVersion parses versions like 2.10.0, v2.1 or 1.0.0-beta.2+build.5. Any number of dot separated
+// numbers is accepted. Build metadata after + is ignored.
+func parseVersion(s string) (semver, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v semver
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.prerelease = strings.Split(s[i+1:], ".")
+		for _, id := range v.prerelease {
+			if id == "" {
+				return semver{}, false
+			}
+		}
+		s = s[:i]
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || strings.TrimLeft(part, "0123456789") != "" {
+			return semver{}, false
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semver{}, false
+		}
+		v.core = append(v.core, n)
+	}
+	return v, true
+}
+
+// normalizeVersion is the form of a string that the semver strategy compares. Surrounding whitespace
+// is removed and nothing else, so 2.1 and 2.1.0 or v2.1.0 and 2.1.0 are still different strings even
+// though they are the same version.
+func normalizeVersion(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, the same as or newer than b. A prerelease
+// is older than the same version without one.
+func compareVersions(a, b semver) int {
+	if c := compareCore(a.core, b.core); c != 0 {
+		return c
+	}
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+	return comparePrereleases(a.prerelease, b.prerelease)
+}
+
+// compareCore compares the numbers of two versions. Missing numbers are 0.
+func compareCore(a, b []uint64) int {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		var x, y uint64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// comparePrereleases compares prereleases one identifier at a time. When one is a prefix of the
+// other, the shorter one is older.
+func comparePrereleases(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := comparePrerelease(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparePrerelease compares prerelease identifiers. Numbers compare numerically and are older than
+// other identifiers, which compare as strings.
+func comparePrerelease(a, b string) int {
+	x, xErr := strconv.ParseUint(a, 10, 64)
+	y, yErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case xErr == nil && yErr == nil:
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	case xErr == nil:
+		return -1
+	case yErr == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// versionChange is versionUpgraded or versionDowngraded when old and new are both versions and one
+// is newer, or "" otherwise. Strings that differ but are the same version, like 2.1 and 2.1.0, get
+// no note.
+func versionChange(old, new interface{}) string {
+	oldString, ok := old.(string)
+	if !ok {
+		return ""
+	}
+	newString, ok := new.(string)
+	if !ok {
+		return ""
+	}
+	oldVersion, ok := parseVersion(oldString)
+	if !ok {
+		return ""
+	}
+	newVersion, ok := parseVersion(newString)
+	if !ok {
+		return ""
+	}
+	switch compareVersions(oldVersion, newVersion) {
+	case -1:
+		return versionUpgraded
+	case 1:
+		return versionDowngraded
+	default:
+		return ""
+	}
+}
+
+// noteVersionChanges notes whether versions at key paths with a semver rule were upgraded or
+// downgraded.
+func noteVersionChanges(rules []compareRule, delta plistDiff) {
+	for i := range delta {
+		d := &delta[i]
+		if d.equal || d.keys == nil {
+			continue
+		}
+		for j := range rules {
+			if !matchKeyPathOrParent([]string{rules[j].pattern}, d.keys) {
+				continue
+			}
+			if rules[j].strategy == strategySemver {
+				d.note = versionChange(d.old, d.new)
+			}
+			break
+		}
+	}
+}
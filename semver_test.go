@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSemverPath(t *testing.T) {
+	for _, td := range []struct {
+		old, new string
+		// wantChange is false when the strings are equal
+		wantChange bool
+		wantNote   string
+	}{
+		{old: "2.1.0", new: "2.10.0", wantChange: true, wantNote: versionUpgraded},
+		{old: "2.10.0", new: "2.1.0", wantChange: true, wantNote: versionDowngraded},
+		{old: "1.0.0-rc.1", new: "1.0.0", wantChange: true, wantNote: versionUpgraded},
+		{old: "1.0.0-rc.2", new: "1.0.0-rc.10", wantChange: true, wantNote: versionUpgraded},
+		{old: "2.1", new: "2.1.0", wantChange: true},
+		{old: "v2.1.0", new: "2.1.0", wantChange: true},
+		{old: "2.1.0+build.1", new: "2.1.0+build.2", wantChange: true},
+		{old: "2.1.0", new: "2.1.0 "},
+		{old: "2.1.0", new: "2.1.0"},
+		{old: "beta", new: "gamma", wantChange: true},
+		{old: "2.1.0", new: "latest", wantChange: true},
+	} {
+		td := td
+		t.Run(td.old+" to "+td.new, func(t *testing.T) {
+			rule, err := parseCompareRule("Version=" + strategySemver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := &differ{CompareRules: []compareRule{rule}}
+			plist := func(version string) []byte {
+				return []byte(`<plist version="1.0"><dict><key>Version</key><string>` + version + `</string></dict></plist>`)
+			}
+			delta, err := d.diffData(plist(td.old), plist(td.new))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := delta.changes() > 0; got != td.wantChange {
+				t.Fatalf("changed = %t, want %t:\n%s", got, td.wantChange, delta)
+			}
+			if td.wantChange && delta[0].note != td.wantNote {
+				t.Errorf("note = %q, want %q", delta[0].note, td.wantNote)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"howett.net/plist"
+)
+
+// snapshotVersion is the version of the snapshot file format
+const snapshotVersion = 1
+
+// snapshotFile is the serialized form of a snapshot. It is stored as a binary plist.
+type snapshotFile struct {
+	Version int                      `plist:"version"`
+	Tree    string                   `plist:"tree"`
+	Created time.Time                `plist:"created"`
+	Files   map[string]snapshotEntry `plist:"files"`
+}
+
+type snapshotEntry struct {
+	Data    []byte    `plist:"data"`
+	ModTime time.Time `plist:"modtime"`
+}
+
+// writeSnapshot serializes snap to w. tree is the path the snapshot was taken from.
+func writeSnapshot(w io.Writer, tree string, snap *memFS) error {
+	sf := snapshotFile{
+		Version: snapshotVersion,
+		Tree:    tree,
+		Created: time.Now(),
+		Files:   map[string]snapshotEntry{},
+	}
+	err := fs.WalkDir(snap, ".", func(filename string, dir fs.DirEntry, err error) error {
+		if err != nil || dir.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(snap, filename)
+		if err != nil {
+			return err
+		}
+		sf.Files[filename] = snapshotEntry{
+			Data:    data,
+			ModTime: snap.modTimes[filename],
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return plist.NewBinaryEncoder(w).Encode(&sf)
+}
+
+// readSnapshot deserializes a snapshot written by writeSnapshot.
+func readSnapshot(r io.Reader) (*memFS, *snapshotFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sf snapshotFile
+	_, err = plist.Unmarshal(data, &sf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a plist-diff snapshot: %v", err)
+	}
+	if sf.Version == 0 {
+		return nil, nil, fmt.Errorf("not a plist-diff snapshot")
+	}
+	if sf.Version != snapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported snapshot version %d", sf.Version)
+	}
+	snap := newMemFS()
+	for filename, entry := range sf.Files {
+		if !fs.ValidPath(filename) {
+			return nil, nil, fmt.Errorf("invalid path in snapshot: %q", filename)
+		}
+		err = writeSnapshotEntry(snap, filename, entry)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return snap, &sf, nil
+}
+
+func writeSnapshotEntry(snap *memFS, filename string, entry snapshotEntry) error {
+	dir := path.Dir(filename)
+	if dir != "." {
+		err := snap.MkdirAll(dir, 0o755)
+		if err != nil {
+			return err
+		}
+	}
+	err := snap.WriteFile(filename, entry.Data, 0o644)
+	if err != nil {
+		return err
+	}
+	snap.modTimes[filename] = entry.ModTime
+	return nil
+}
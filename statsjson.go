@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonStats is the --stats-json report. Fields are only ever added so that dashboards can rely on
+// the existing ones.
+type jsonStats struct {
+	FilesCompared  int     `json:"files_compared"`
+	FilesChanged   int     `json:"files_changed"`
+	Added          int     `json:"added"`
+	Removed        int     `json:"removed"`
+	Changed        int     `json:"changed"`
+	BytesRead      int64   `json:"bytes_read"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// diffStats totals the changed files and the changes in diff. Added and removed files count as one
+// added or removed change.
+func diffStats(diff fsDiff) jsonStats {
+	var stats jsonStats
+	for _, p := range diff {
+		changed := false
+		for i := range p {
+			if p[i].equal || p[i].keys == nil {
+				continue
+			}
+			changed = true
+			switch p[i].changeKind() {
+			case changeAdded:
+				stats.Added++
+			case changeRemoved:
+				stats.Removed++
+			default:
+				stats.Changed++
+			}
+		}
+		if changed {
+			stats.FilesChanged++
+		}
+	}
+	return stats
+}
+
+// writeStatsJSON writes the stats for diff from d as a single line of JSON.
+func writeStatsJSON(w io.Writer, d *differ, diff fsDiff, elapsed time.Duration) error {
+	stats := diffStats(diff)
+	stats.FilesCompared = d.FilesCompared
+	stats.BytesRead = d.BytesRead
+	stats.ElapsedSeconds = elapsed.Seconds()
+	return json.NewEncoder(w).Encode(&stats)
+}
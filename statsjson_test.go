@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatsJSON(t *testing.T) {
+	a, b := flagdata("intersection", "a"), flagdata("intersection", "b")
+	var size int64
+	for _, dir := range []string{a, b} {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			info, err := entry.Info()
+			size += info.Size()
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--name-only", "--stats-json", a, b}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d. stderr: %s", code, stderr.String())
+	}
+	var got jsonStats
+	err := json.Unmarshal(stderr.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ElapsedSeconds <= 0 {
+		t.Errorf("elapsed_seconds is %v", got.ElapsedSeconds)
+	}
+	got.ElapsedSeconds = 0
+	want := jsonStats{
+		FilesCompared: 3,
+		FilesChanged:  3,
+		Added:         1,
+		Removed:       1,
+		Changed:       1,
+		BytesRead:     size,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stats (-want +got):\n%s", diff)
+	}
+	if stdout.String() != "a-only.plist\nb-only.plist\nboth.plist\n" {
+		t.Errorf("unexpected stdout %q", stdout.String())
+	}
+}
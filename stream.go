@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// errStopWalk stops a walk from walkSorted when the comparison no longer needs its files
+var errStopWalk = errors.New("stop walk")
+
+// walkResult is a file found by walkSorted or the error that ended the walk
+type walkResult struct {
+	path string
+	err  error
+}
+
+// walkSorted sends the plist files in fsys to the returned channel in the order of comparePaths.
+// The channel is closed after the last file or an error. Closing done stops the walk early.
+func (d *differ) walkSorted(fsys fs.FS, done <-chan struct{}) <-chan walkResult {
+	results := make(chan walkResult, 64)
+	go func() {
+		defer close(results)
+		err := d.walkPlistFiles(fsys, func(path string) error {
+			select {
+			case results <- walkResult{path: path}:
+				return nil
+			case <-done:
+				return errStopWalk
+			}
+		})
+		if err != nil && err != errStopWalk {
+			select {
+			case results <- walkResult{err: err}:
+			case <-done:
+			}
+		}
+	}()
+	return results
+}
+
+// comparePaths orders slash separated paths the way fs.WalkDir visits them, which is by comparing
+// them one path element at a time. This differs from comparing the strings when an element is a
+// prefix of another, like "a/b" and "a.plist".
+func comparePaths(x, y string) int {
+	for {
+		xElem, xRest, xMore := cutPath(x)
+		yElem, yRest, yMore := cutPath(y)
+		if c := strings.Compare(xElem, yElem); c != 0 {
+			return c
+		}
+		switch {
+		case !xMore && !yMore:
+			return 0
+		case !xMore:
+			return -1
+		case !yMore:
+			return 1
+		}
+		x, y = xRest, yRest
+	}
+}
+
+// cutPath splits the first element from a slash separated path
+func cutPath(p string) (elem, rest string, more bool) {
+	i := strings.IndexByte(p, '/')
+	if i < 0 {
+		return p, "", false
+	}
+	return p[:i], p[i+1:], true
+}
+
+// mergedWalk walks two trees with walkSorted at the same time and merge-joins their files
+type mergedWalk struct {
+	a, b sortedWalk
+}
+
+// sortedWalk is the file a walkSorted walk is at
+type sortedWalk struct {
+	files <-chan walkResult
+	path  string
+	ok    bool
+}
+
+func (w *sortedWalk) advance() error {
+	r, ok := <-w.files
+	w.path, w.ok = r.path, ok
+	return r.err
+}
+
+// mergeWalk starts walking a and b. Closing done stops both walks.
+func (d *differ) mergeWalk(a, b fs.FS, done <-chan struct{}) (*mergedWalk, error) {
+	m := &mergedWalk{
+		a: sortedWalk{files: d.walkSorted(a, done)},
+		b: sortedWalk{files: d.walkSorted(b, done)},
+	}
+	err := m.a.advance()
+	if err != nil {
+		return nil, err
+	}
+	err = m.b.advance()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// next returns the next file in either tree and which trees have it. ok is false when both walks
+// are finished.
+func (m *mergedWalk) next() (filename string, inA, inB, ok bool, err error) {
+	if !m.a.ok && !m.b.ok {
+		return "", false, false, false, nil
+	}
+	inA, inB = m.a.ok, m.b.ok
+	if inA && inB {
+		c := comparePaths(m.a.path, m.b.path)
+		inA, inB = c <= 0, c >= 0
+	}
+	filename = m.b.path
+	if inA {
+		filename = m.a.path
+		err = m.a.advance()
+		if err != nil {
+			return "", false, false, false, err
+		}
+	}
+	if inB {
+		err = m.b.advance()
+		if err != nil {
+			return "", false, false, false, err
+		}
+	}
+	return filename, inA, inB, true, nil
+}
+
+// diffFSStreaming is diffFSCached for trees that are too big to list in memory. It walks a and b
+// at the same time and compares each file as soon as both walks have passed it, so only the
+// diffs of files with changes are kept.
+func (d *differ) diffFSStreaming(a, b fs.FS, cache *diffCache) (bool, fsDiff, error) {
+	err := d.checkRequired(a, b)
+	if err != nil {
+		return false, nil, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	walk, err := d.mergeWalk(a, b, done)
+	if err != nil {
+		return false, nil, err
+	}
+	// found is the files from d.Files that are in either tree for checkMissing
+	found := map[string]struct{}{}
+	delta := fsDiff{}
+	eq := true
+	for {
+		filename, inA, inB, ok, werr := walk.next()
+		if werr != nil {
+			return false, nil, werr
+		}
+		if !ok {
+			break
+		}
+		if d.Files[filename] {
+			found[filename] = struct{}{}
+		}
+		if d.Intersection && !(inA && inB) {
+			continue
+		}
+		df, derr := cache.diffFSFilename(d, a, b, filename)
+		if derr != nil {
+			return false, nil, derr
+		}
+		if df != nil {
+			delta[filename] = df
+			eq = eq && df.changes() == 0
+		}
+	}
+	err = d.checkMissing(found, found)
+	if err != nil {
+		return false, nil, err
+	}
+	return eq, delta, nil
+}
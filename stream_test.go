@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffFSStreamingMatches(t *testing.T) {
+	plist := func(s string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(`<plist version="1.0"><string>` + s + `</string></plist>`)}
+	}
+	a := fstest.MapFS{
+		"a.plist":       plist("1"),
+		"a/b.plist":     plist("1"),
+		"a/c/d.plist":   plist("1"),
+		"removed.plist": plist("1"),
+		"same.plist":    plist("1"),
+		"z/z.plist":     plist("1"),
+	}
+	b := fstest.MapFS{
+		"a.plist":     plist("2"),
+		"a/b.plist":   plist("1"),
+		"a/c/d.plist": plist("2"),
+		"added.plist": plist("1"),
+		"same.plist":  plist("1"),
+		"z/z.plist":   plist("2"),
+	}
+	for _, intersection := range []bool{false, true} {
+		t.Run(fmt.Sprintf("intersection=%t", intersection), func(t *testing.T) {
+			wantEq, want, err := (&differ{Intersection: intersection}).diffFS(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotEq, got, err := (&differ{Intersection: intersection, Streaming: true}).diffFS(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotEq != wantEq {
+				t.Errorf("streaming eq = %t, want %t", gotEq, wantEq)
+			}
+			if got.String() != want.String() {
+				t.Errorf("streaming output differs:\n%s", cmp.Diff(want.String(), got.String()))
+			}
+		})
+	}
+}
+
+// BenchmarkDiffFSPeakMemory reports the peak heap used by diffing two large trees where one file in
+// a hundred changed, with and without --streaming.
+func BenchmarkDiffFSPeakMemory(b *testing.B) {
+	const files = 20000
+	a, c := fstest.MapFS{}, fstest.MapFS{}
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("dir%d/sub%d/file%d.plist", i%10, i%100, i)
+		a[name] = &fstest.MapFile{Data: syntheticPlist(5, 0)}
+		c[name] = &fstest.MapFile{Data: syntheticPlist(5, i%100/99)}
+	}
+	// collect often so that the heap is close to what is live rather than what is waiting for GC
+	defer debug.SetGCPercent(debug.SetGCPercent(5))
+	for _, streaming := range []bool{false, true} {
+		b.Run(fmt.Sprintf("streaming=%t", streaming), func(b *testing.B) {
+			d := &differ{Streaming: streaming}
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				used := peakHeap(func() {
+					_, _, err := d.diffFS(a, c)
+					if err != nil {
+						b.Fatal(err)
+					}
+				})
+				if used > peak {
+					peak = used
+				}
+			}
+			b.ReportMetric(float64(peak), "peak-heap-B")
+		})
+	}
+}
+
+// peakHeap runs fn and returns the most heap it saw in use above what was in use before fn. The heap
+// is sampled every 100µs, so short spikes may be missed.
+func peakHeap(fn func()) uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	read := func() uint64 {
+		metrics.Read(sample)
+		return sample[0].Value.Uint64()
+	}
+	runtime.GC()
+	base := read()
+	peak := base
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			if n := read(); n > peak {
+				peak = n
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	fn()
+	close(done)
+	<-sampled
+	return peak - base
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// origins of a change in a 3-way diff
+const (
+	originA        = "a-only"
+	originB        = "b-only"
+	originBoth     = "both"
+	originConflict = "conflict"
+)
+
+// mergeDiff is a 3-way diff keyed by filename
+type mergeDiff map[string][]mergeEntry
+
+// mergeEntry is a value that changed from base in a, b or both
+type mergeEntry struct {
+	path   string
+	keys   []interface{}
+	origin string
+	base   interface{}
+	a      interface{}
+	b      interface{}
+}
+
+// diff3 compares a and b to their common ancestor base and classifies each change by where it came from.
+func (d *differ) diff3(base, a, b string) (bool, mergeDiff, error) {
+	trees, err := d.getFSs(base, a, b)
+	if err != nil {
+		return false, nil, err
+	}
+	baseFS, aFS, bFS := trees[0], trees[1], trees[2]
+	_, aDiff, err := d.diffFS(baseFS, aFS)
+	if err != nil {
+		return false, nil, err
+	}
+	_, bDiff, err := d.diffFS(baseFS, bFS)
+	if err != nil {
+		return false, nil, err
+	}
+	delta := mergeDiff{}
+	for filename := range aDiff {
+		entries := mergeFile(aDiff[filename], bDiff[filename])
+		if len(entries) > 0 {
+			delta[filename] = entries
+		}
+	}
+	for filename := range bDiff {
+		if _, ok := aDiff[filename]; ok {
+			continue
+		}
+		entries := mergeFile(nil, bDiff[filename])
+		if len(entries) > 0 {
+			delta[filename] = entries
+		}
+	}
+	return len(delta) == 0, delta, nil
+}
+
+// mergeFile combines the base->a and base->b diffs for one file. A change on one side conflicts with
+// changes on the other side at the same key path or under it, like a change to X.Y in a when b
+// removes X. Those are reported as one entry at the outermost key path. Pseudo-diffs like mtime
+// aren't merged.
+func mergeFile(aDiffs, bDiffs plistDiff) []mergeEntry {
+	aChanges, bChanges := mergeChanges(aDiffs), mergeChanges(bDiffs)
+	var entries []mergeEntry
+	for _, fd := range aChanges {
+		if changedAbove(fd, bChanges, false) {
+			continue
+		}
+		entries = append(entries, mergeAt(fd, bChanges, originA))
+	}
+	for _, fd := range bChanges {
+		// changes at the same key path as a change in a were merged with it
+		if changedAbove(fd, aChanges, true) {
+			continue
+		}
+		entries = append(entries, mergeAt(fd, aChanges, originB))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return keysLess(entries[i].keys, entries[j].keys)
+	})
+	return entries
+}
+
+// mergeChanges returns the diffs that are changes to values
+func mergeChanges(diffs plistDiff) []*FileDiff {
+	var changes []*FileDiff
+	for i := range diffs {
+		if !diffs[i].equal && diffs[i].keys != nil {
+			changes = append(changes, &diffs[i])
+		}
+	}
+	return changes
+}
+
+// changedAbove is true when one of others is at a parent key path of fd, or at the same one when
+// inclusive is set.
+func changedAbove(fd *FileDiff, others []*FileDiff, inclusive bool) bool {
+	for _, other := range others {
+		if hasKeyPrefix(fd.keys, other.keys) && (inclusive || len(other.keys) < len(fd.keys)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeAt merges fd, a change from the side origin, with the changes from the other side at or under
+// its key path.
+func mergeAt(fd *FileDiff, others []*FileDiff, origin string) mergeEntry {
+	var under []*FileDiff
+	for _, other := range others {
+		if hasKeyPrefix(other.keys, fd.keys) {
+			under = append(under, other)
+		}
+	}
+	entry := mergeEntry{
+		path:   fd.path,
+		keys:   fd.keys,
+		origin: origin,
+		base:   fd.old,
+	}
+	theirs := fd.old
+	switch {
+	case len(under) == 1 && len(under[0].keys) == len(fd.keys):
+		theirs = under[0].new
+		entry.origin = originConflict
+		// cmp.Equal rather than reflect.DeepEqual so that dates are compared by instant
+		if cmp.Equal(fd.new, theirs) {
+			entry.origin = originBoth
+		}
+	case len(under) > 0:
+		entry.origin = originConflict
+		theirs = patchValue(fd.old, fd.keys, under)
+	}
+	entry.a, entry.b = fd.new, theirs
+	if origin == originB {
+		entry.a, entry.b = theirs, fd.new
+	}
+	return entry
+}
+
+// patchValue returns base, the value at keys, with changes under keys applied to it
+func patchValue(base interface{}, keys []interface{}, changes []*FileDiff) interface{} {
+	relative := make(plistDiff, len(changes))
+	for i, change := range changes {
+		relative[i] = *change
+		relative[i].keys = change.keys[len(keys):]
+	}
+	patch, ok := overlayPatch(relative)
+	if !ok {
+		return plistUnparseable
+	}
+	return applyOverlay(base, patch)
+}
+
+// keysLess orders key paths by their keys, with array indexes in numeric order and parents before
+// their children.
+func keysLess(a, b []interface{}) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		ai, aIndex := a[i].(int)
+		bi, bIndex := b[i].(int)
+		if aIndex && bIndex {
+			return ai < bi
+		}
+		return fmt.Sprint(a[i]) < fmt.Sprint(b[i])
+	}
+	return len(a) < len(b)
+}
+
+// merge renders a mergeDiff as text
+func (f *formatter) merge(diff mergeDiff) string {
+	filenames := make([]string, 0, len(diff))
+	for filename := range diff {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	var s string
+	for _, filename := range filenames {
+		s += filename + ":\n"
+		for _, entry := range diff[filename] {
+			s += fmt.Sprintf("\t[%s] %s\n", entry.origin, f.keyPath(entry.path, entry.keys))
+			s += f.mergeValue("base", entry.base)
+			if entry.origin != originB {
+				s += f.mergeValue("a", entry.a)
+			}
+			if entry.origin != originA && entry.origin != originBoth {
+				s += f.mergeValue("b", entry.b)
+			}
+		}
+		s += "\n"
+	}
+	return s
+}
+
+func (f *formatter) mergeValue(side string, v interface{}) string {
+	if v == nil {
+		return fmt.Sprintf("\t\t%-5s %s\n", side+":", plistMissing)
+	}
+	return fmt.Sprintf("\t\t%-5s %s%s\n", side+":", f.value(v), typeSuffix(v))
+}
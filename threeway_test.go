@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testPath is the cmp path for keys like root["X"][0]
+func testPath(keys []interface{}) string {
+	p := "root"
+	for _, key := range keys {
+		if i, ok := key.(int); ok {
+			p += fmt.Sprintf("[%d]", i)
+			continue
+		}
+		p += fmt.Sprintf("[%q]", key)
+	}
+	return p
+}
+
+func TestMergeFile(t *testing.T) {
+	change := func(key interface{}, old, new interface{}) FileDiff {
+		return FileDiff{path: testPath([]interface{}{key}), keys: []interface{}{key}, old: old, new: new}
+	}
+	child := func(key, sub interface{}, old, new interface{}) FileDiff {
+		keys := []interface{}{key, sub}
+		return FileDiff{path: testPath(keys), keys: keys, old: old, new: new}
+	}
+	for _, td := range []struct {
+		name string
+		a, b plistDiff
+		want []mergeEntry
+	}{
+		{
+			name: "clean",
+			a:    plistDiff{change("B", "1", "2")},
+			b:    plistDiff{change("A", "1", "3")},
+			want: []mergeEntry{
+				{path: `root["A"]`, keys: []interface{}{"A"}, origin: originB, base: "1", a: "1", b: "3"},
+				{path: `root["B"]`, keys: []interface{}{"B"}, origin: originA, base: "1", a: "2", b: "1"},
+			},
+		},
+		{
+			name: "same change",
+			a:    plistDiff{change("A", "1", "2")},
+			b:    plistDiff{change("A", "1", "2")},
+			want: []mergeEntry{
+				{path: `root["A"]`, keys: []interface{}{"A"}, origin: originBoth, base: "1", a: "2", b: "2"},
+			},
+		},
+		{
+			name: "conflict",
+			a:    plistDiff{change("A", "1", "2")},
+			b:    plistDiff{change("A", "1", "3")},
+			want: []mergeEntry{
+				{path: `root["A"]`, keys: []interface{}{"A"}, origin: originConflict, base: "1", a: "2", b: "3"},
+			},
+		},
+		{
+			name: "b removes the parent of a change in a",
+			a:    plistDiff{child("X", "Y", "1", "2"), child("X", "Z", "1", "3"), change("W", "1", "2")},
+			b:    plistDiff{change("X", map[string]interface{}{"Y": "1", "Z": "1", "V": "1"}, nil)},
+			want: []mergeEntry{
+				{path: `root["W"]`, keys: []interface{}{"W"}, origin: originA, base: "1", a: "2", b: "1"},
+				{
+					path:   `root["X"]`,
+					keys:   []interface{}{"X"},
+					origin: originConflict,
+					base:   map[string]interface{}{"Y": "1", "Z": "1", "V": "1"},
+					a:      map[string]interface{}{"Y": "2", "Z": "3", "V": "1"},
+					b:      nil,
+				},
+			},
+		},
+		{
+			name: "a replaces the parent of a change in b",
+			a:    plistDiff{change("X", []interface{}{"1", "2"}, "flat")},
+			b:    plistDiff{child("X", 1, nil, "3")},
+			want: []mergeEntry{
+				{
+					path:   `root["X"]`,
+					keys:   []interface{}{"X"},
+					origin: originConflict,
+					base:   []interface{}{"1", "2"},
+					a:      "flat",
+					b:      []interface{}{"1", "3", "2"},
+				},
+			},
+		},
+		{
+			name: "same instant in different locations",
+			a:    plistDiff{change("A", time.Unix(1, 0).UTC(), time.Unix(2, 0).UTC())},
+			b:    plistDiff{change("A", time.Unix(1, 0).UTC(), time.Unix(2, 0).In(time.FixedZone("EST", -5*60*60)))},
+			want: []mergeEntry{
+				{
+					path:   `root["A"]`,
+					keys:   []interface{}{"A"},
+					origin: originBoth,
+					base:   time.Unix(1, 0).UTC(),
+					a:      time.Unix(2, 0).UTC(),
+					b:      time.Unix(2, 0).In(time.FixedZone("EST", -5*60*60)),
+				},
+			},
+		},
+		{
+			name: "pseudo-diffs are left out",
+			a:    plistDiff{{path: "mtime", old: time.Unix(1, 0), new: time.Unix(2, 0)}, change("A", "1", "2")},
+			b:    plistDiff{{path: "mtime", old: time.Unix(1, 0), new: time.Unix(3, 0)}},
+			want: []mergeEntry{
+				{path: `root["A"]`, keys: []interface{}{"A"}, origin: originA, base: "1", a: "2", b: "1"},
+			},
+		},
+	} {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			got := mergeFile(td.a, td.b)
+			if diff := cmp.Diff(td.want, got, cmp.AllowUnexported(mergeEntry{})); diff != "" {
+				t.Errorf("entries (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
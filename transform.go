@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// string transforms for transformRule
+const (
+	transformLowercase  = "lowercase"
+	transformTrimPrefix = "trim-prefix"
+	transformTrimSuffix = "trim-suffix"
+	transformStrip      = "strip"
+)
+
+// transformValueTransform is the name of the transformer from transformRuleOptions
+const transformValueTransform = "transformValue"
+
+// transformRule rewrites string values at key paths matching pattern, and everything under them,
+// before they are compared.
+type transformRule struct {
+	// pattern is a path.Match pattern for key paths like the ones for --numeric-threshold-path
+	pattern string
+	// transform is one of transformLowercase, transformTrimPrefix, transformTrimSuffix or transformStrip
+	transform string
+	// arg is the argument for transformTrimPrefix and transformTrimSuffix
+	arg string
+	// re is the regular expression for transformStrip
+	re *regexp.Regexp
+}
+
+// parseTransformRule parses a rule written as PATH=TRANSFORM or PATH=TRANSFORM:ARG. PATH ends at the
+// first = so that ARG may contain one.
+func parseTransformRule(s string) (transformRule, error) {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return transformRule{}, fmt.Errorf("invalid transform path %q: must be PATH=TRANSFORM", s)
+	}
+	rule := transformRule{
+		pattern:   s[:i],
+		transform: s[i+1:],
+	}
+	_, err := path.Match(rule.pattern, "")
+	if err != nil {
+		return transformRule{}, fmt.Errorf("invalid transform path %q: %v", s, err)
+	}
+	hasArg := false
+	if j := strings.Index(rule.transform, ":"); j >= 0 {
+		rule.transform, rule.arg = rule.transform[:j], rule.transform[j+1:]
+		hasArg = true
+	}
+	switch rule.transform {
+	case transformLowercase:
+		if hasArg {
+			return transformRule{}, fmt.Errorf("invalid transform path %q: lowercase doesn't take an argument", s)
+		}
+	case transformTrimPrefix, transformTrimSuffix:
+		if !hasArg {
+			return transformRule{}, fmt.Errorf("invalid transform path %q: %s needs the text to trim like %s:STR", s, rule.transform, rule.transform)
+		}
+	case transformStrip:
+		rule.re, err = regexp.Compile(rule.arg)
+		if err != nil || !hasArg {
+			return transformRule{}, fmt.Errorf("invalid transform path %q: strip needs a regular expression like strip:REGEXP", s)
+		}
+	default:
+		return transformRule{}, fmt.Errorf("invalid transform path %q: unknown transform %q", s, rule.transform)
+	}
+	return rule, nil
+}
+
+// apply transforms s
+func (r transformRule) apply(s string) string {
+	switch r.transform {
+	case transformLowercase:
+		return strings.ToLower(s)
+	case transformTrimPrefix:
+		return strings.TrimPrefix(s, r.arg)
+	case transformTrimSuffix:
+		return strings.TrimSuffix(s, r.arg)
+	case transformStrip:
+		return r.re.ReplaceAllString(s, "")
+	default:
+		return s
+	}
+}
+
+// transformRuleOptions returns the options for rules. Like compare rules, only the first rule
+// matching a path applies to it.
+func transformRuleOptions(rules []transformRule) []cmp.Option {
+	first := func(p cmp.Path) int {
+		keys := pathKeys(p)
+		for i := range rules {
+			if matchKeyPathOrParent([]string{rules[i].pattern}, keys) {
+				return i
+			}
+		}
+		return -1
+	}
+	opts := make([]cmp.Option, len(rules))
+	for i := range rules {
+		i := i
+		rule := rules[i]
+		opts[i] = cmp.FilterPath(func(p cmp.Path) bool {
+			return first(p) == i
+		}, cmp.Transformer(transformValueTransform, rule.apply))
+	}
+	return opts
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/alecthomas/kong"
+)
+
+type watchTargetsCmd struct {
+	Config string `kong:"arg,type=existingfile,help='plist file with an array of watch targets. each is a dict with the tree to watch, an optional prefix for its output lines and the flag names of any other options like ignore-key'"`
+}
+
+// watchTarget is one entry in the watch-targets config. Its fields are set from the dict like
+// plistConfig sets flags.
+type watchTarget struct {
+	Tree   string `kong:"required,help='directory tree, file, archive or quoted glob to watch'"`
+	Prefix string `kong:"help='written before each line of output from this target. defaults to the tree'"`
+	compareOptions
+}
+
+// Run watches every target in Config until one of them fails or ctx is done.
+func (c *watchTargetsCmd) Run(kctx *kong.Context, ctx context.Context) error {
+	return c.watch(ctx, kctx.Stdout, kctx.Stderr)
+}
+
+// watch is Run with the output going to stdout and stderr. When a target fails, the others are
+// stopped before it returns.
+func (c *watchTargetsCmd) watch(ctx context.Context, stdout, stderr io.Writer) error {
+	targets, err := readWatchTargets(c.Config)
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	watches := make([]func(ctx context.Context) error, len(targets))
+	for i := range targets {
+		t := &targets[i]
+		prefix := t.Prefix
+		if prefix == "" {
+			prefix = t.Tree
+		}
+		out := &prefixWriter{w: stdout, mu: &mu, prefix: "[" + prefix + "] "}
+		t.log = newLogger(&prefixWriter{w: stderr, mu: &mu, prefix: "[" + prefix + "] "}, t.LogLevel)
+		d, derr := t.differ(stderr)
+		if derr != nil {
+			return fmt.Errorf("%s: %v", prefix, derr)
+		}
+		f := t.formatter()
+		watches[i] = func(ctx context.Context) error {
+			werr := d.watch(ctx, t.Tree, out, f)
+			if werr != nil {
+				return fmt.Errorf("%s: %v", prefix, werr)
+			}
+			return nil
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(watches))
+	for _, w := range watches {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			werr := w(ctx)
+			if werr != nil {
+				errs <- werr
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	// the first error, or nil when there were none
+	return <-errs
+}
+
+// readWatchTargets reads the array of target dicts in a watch-targets config.
+func readWatchTargets(filename string) ([]watchTarget, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := decodePlist(data, decodeOptions{maxDepth: defaultMaxNesting})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	items, ok := val.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("%s: must be an array of target dicts", filename)
+	}
+	targets := make([]watchTarget, len(items))
+	for i, item := range items {
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: target %d must be a dict", filename, i)
+		}
+		parser, err := kong.New(&targets[i], kongVars, kong.Resolvers(plistResolver(values)))
+		if err != nil {
+			return nil, err
+		}
+		_, err = parser.Parse(nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: target %d: %v", filename, i, err)
+		}
+	}
+	return targets, nil
+}
+
+// prefixWriter writes each complete line written to it to w with prefix in front. mu is shared by
+// the prefixWriters for the same w so that lines from different targets aren't mixed together.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	lines := bytes.SplitAfter(p.buf[:i+1], []byte("\n"))
+	var out []byte
+	for _, line := range lines {
+		if len(line) > 0 {
+			out = append(append(out, p.prefix...), line...)
+		}
+	}
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}